@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+)
+
+func printCounts(title string, counts map[string]*switchsim.VerifyCounts) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("%-24s %10s %10s %10s %10s %10s %10s %10s\n", title, "sent", "received", "missing", "duplicated", "miscounted", "misrouted", "unexpected")
+	for _, name := range names {
+		c := counts[name]
+		fmt.Printf("%-24s %10d %10d %10d %10d %10d %10d %10d\n", name, c.Sent, c.Received, c.Missing, c.Duplicated, c.Miscounted, c.Misrouted, c.Unexpected)
+	}
+	fmt.Println()
+}
+
+func main() {
+	ledgerFile := flag.String("ledger", "ledger.jsonl", "ledger the simulator wrote with -ledger")
+	receivedFile := flag.String("received", "received.jsonl", "flows the collectors received, in the ledger format")
+	jsonOut := flag.Bool("json", false, "print the verification as JSON")
+	flag.Parse()
+
+	sent, err := switchsim.ReadLedger(*ledgerFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read ledger: %v\n", err)
+		os.Exit(2)
+	}
+	received, err := switchsim.ReadLedger(*receivedFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read received flows: %v\n", err)
+		os.Exit(2)
+	}
+	v := switchsim.VerifyLedger(sent, received)
+	if *jsonOut {
+		out, _ := json.MarshalIndent(v, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printCounts("switch", v.Switches)
+		printCounts("collector", v.Collectors)
+		for _, p := range v.Problems {
+			fmt.Println(p)
+		}
+		if v.OK() {
+			fmt.Printf("All %d flows received once, as sent\n", v.Total.Sent)
+		} else {
+			fmt.Printf("%d of %d flows missing, %d duplicated, %d miscounted, %d misrouted, %d unexpected\n",
+				v.Total.Missing, v.Total.Sent, v.Total.Duplicated, v.Total.Miscounted, v.Total.Misrouted, v.Total.Unexpected)
+		}
+	}
+	if !v.OK() {
+		os.Exit(1)
+	}
+}
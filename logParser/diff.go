@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+)
+
+// messageKey identifies a message for alignment: who sent it, its cmd and,
+// for add_mapping, the mapping component.
+func messageKey(m logMessage) string {
+	direction := "switch"
+	if m.Server {
+		direction = "gateway"
+	}
+	key := direction + " " + m.Cmd
+	if addMapping, ok := m.Message.(*switchsim.SwitchAddMappingMessage); ok {
+		key += " " + addMapping.Data.Component
+	}
+	return key
+}
+
+type messagePair struct {
+	a, b int // index into each session, -1 when the message has no counterpart
+}
+
+// alignSessions pairs up the messages of two sessions along their longest
+// common subsequence of message keys.
+func alignSessions(a []logMessage, b []logMessage) []messagePair {
+	table := newLCSTable(a, b)
+	var pairs []messagePair
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case table.ka[i] == table.kb[j]:
+			pairs = append(pairs, messagePair{i, j})
+			i++
+			j++
+		case table.row(i + 1)[j] >= table.row(i)[j+1]:
+			pairs = append(pairs, messagePair{i, -1})
+			i++
+		default:
+			pairs = append(pairs, messagePair{-1, j})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		pairs = append(pairs, messagePair{i, -1})
+	}
+	for ; j < len(b); j++ {
+		pairs = append(pairs, messagePair{-1, j})
+	}
+	return pairs
+}
+
+// lcsTable holds the lengths of the longest common subsequences of a[i:] and
+// b[j:]. The full table of two long logs won't fit in memory, so it keeps
+// every blockRows-th row and recomputes the rows of one block at a time, as
+// the alignment walks down them.
+type lcsTable struct {
+	ka, kb      []int // message keys, numbered
+	blockRows   int
+	checkpoints [][]int32 // row i*blockRows
+	last        []int32   // row len(a), all 0
+	block       [][]int32 // rows first to first+blockRows
+	first       int       // of block, -1 before the first is computed
+}
+
+func newLCSTable(a []logMessage, b []logMessage) *lcsTable {
+	t := &lcsTable{ka: make([]int, len(a)), kb: make([]int, len(b)), first: -1}
+	keys := make(map[string]int)
+	number := func(m logMessage) int {
+		key := messageKey(m)
+		if _, ok := keys[key]; !ok {
+			keys[key] = len(keys)
+		}
+		return keys[key]
+	}
+	for i, m := range a {
+		t.ka[i] = number(m)
+	}
+	for j, m := range b {
+		t.kb[j] = number(m)
+	}
+	t.blockRows = int(math.Sqrt(float64(len(a)))) + 1
+	t.checkpoints = make([][]int32, len(a)/t.blockRows+1)
+	t.last = make([]int32, len(b)+1)
+	row, spare := make([]int32, len(b)+1), make([]int32, len(b)+1)
+	for i := len(a); i >= 0; i-- {
+		if i < len(a) {
+			row, spare = t.step(i, row, spare), row
+		}
+		if i%t.blockRows == 0 {
+			t.checkpoints[i/t.blockRows] = append([]int32(nil), row...)
+		}
+	}
+	return t
+}
+
+// step computes row i from row i+1 into row.
+func (t *lcsTable) step(i int, below []int32, row []int32) []int32 {
+	row[len(t.kb)] = 0
+	for j := len(t.kb) - 1; j >= 0; j-- {
+		switch {
+		case t.ka[i] == t.kb[j]:
+			row[j] = below[j+1] + 1
+		case below[j] >= row[j+1]:
+			row[j] = below[j]
+		default:
+			row[j] = row[j+1]
+		}
+	}
+	return row
+}
+
+// row returns row i, computing its block from the checkpoint below it.
+func (t *lcsTable) row(i int) []int32 {
+	if i == len(t.ka) {
+		return t.last
+	}
+	if i%t.blockRows == 0 {
+		return t.checkpoints[i/t.blockRows]
+	}
+	first := i / t.blockRows * t.blockRows
+	if first != t.first {
+		last := first + t.blockRows
+		if last > len(t.ka) {
+			last = len(t.ka)
+		}
+		if t.block == nil {
+			t.block = make([][]int32, t.blockRows)
+			for k := range t.block {
+				t.block[k] = make([]int32, len(t.kb)+1)
+			}
+		}
+		below := t.row(last)
+		for k := last - 1; k > first; k-- {
+			below = t.step(k, below, t.block[k-first])
+		}
+		t.first = first
+	}
+	return t.block[i-first]
+}
+
+// diffJSON appends one line per differing leaf between a and b. Paths listed
+// in ignore are skipped along with everything below them.
+func diffJSON(path string, a interface{}, b interface{}, ignore map[string]bool, diffs []string) []string {
+	if ignore[path] {
+		return diffs
+	}
+	child := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			aChild, aOk := av[k]
+			bChild, bOk := bv[k]
+			switch {
+			case ignore[child(k)]:
+			case !aOk:
+				diffs = append(diffs, fmt.Sprintf("%s: only in simulated: %s", child(k), jsonString(bChild)))
+			case !bOk:
+				diffs = append(diffs, fmt.Sprintf("%s: only in real: %s", child(k), jsonString(aChild)))
+			default:
+				diffs = diffJSON(child(k), aChild, bChild, ignore, diffs)
+			}
+		}
+		return diffs
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bv):
+				diffs = append(diffs, fmt.Sprintf("%s: only in real: %s", p, jsonString(av[i])))
+			case i >= len(av):
+				diffs = append(diffs, fmt.Sprintf("%s: only in simulated: %s", p, jsonString(bv[i])))
+			default:
+				diffs = diffJSON(p, av[i], bv[i], ignore, diffs)
+			}
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(a, b) {
+		diffs = append(diffs, fmt.Sprintf("%s: %s != %s", path, jsonString(a), jsonString(b)))
+	}
+	return diffs
+}
+
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// diffSessions prints the differences between a real switch session and a
+// simulated one and returns how many it found.
+func diffSessions(realFile string, real []logMessage, simFile string, sim []logMessage, ignore map[string]bool) int {
+	pairs := alignSessions(real, sim)
+
+	// A message whose key goes unmatched on both sides was sent, just at a
+	// different position. Report it once as ORDER instead of MISSING + EXTRA.
+	unmatchedReal := make(map[string]int)
+	unmatchedSim := make(map[string]int)
+	for _, p := range pairs {
+		if p.b < 0 {
+			unmatchedReal[messageKey(real[p.a])]++
+		}
+		if p.a < 0 {
+			unmatchedSim[messageKey(sim[p.b])]++
+		}
+	}
+	reorderedReal := make(map[string]int)
+	reorderedSim := make(map[string]int)
+	for key, n := range unmatchedReal {
+		if unmatchedSim[key] < n {
+			n = unmatchedSim[key]
+		}
+		reorderedReal[key], reorderedSim[key] = n, n
+	}
+
+	differences := 0
+	for _, p := range pairs {
+		switch {
+		case p.b < 0:
+			m := real[p.a]
+			key := messageKey(m)
+			if reorderedReal[key] > 0 {
+				reorderedReal[key]--
+				fmt.Printf("ORDER    %s:%d %s: sent at a different position by the simulator\n", realFile, m.Line, key)
+			} else {
+				fmt.Printf("MISSING  %s:%d %s: not sent by the simulator\n", realFile, m.Line, key)
+			}
+			differences++
+		case p.a < 0:
+			m := sim[p.b]
+			key := messageKey(m)
+			if reorderedSim[key] > 0 {
+				reorderedSim[key]--
+				continue // reported as ORDER from the real side
+			}
+			fmt.Printf("EXTRA    %s:%d %s: not sent by the real switch\n", simFile, m.Line, key)
+			differences++
+		default:
+			r, s := real[p.a], sim[p.b]
+			var rv, sv interface{}
+			json.Unmarshal(r.Raw, &rv)
+			json.Unmarshal(s.Raw, &sv)
+			diffs := diffJSON("", rv, sv, ignore, nil)
+			if len(diffs) == 0 {
+				continue
+			}
+			label := "PAYLOAD "
+			for _, d := range diffs {
+				if strings.HasPrefix(d, "responseCode:") {
+					label = "RESPONSE"
+				}
+			}
+			fmt.Printf("%s %s:%d <-> %s:%d %s\n", label, realFile, r.Line, simFile, s.Line, messageKey(r))
+			for _, d := range diffs {
+				fmt.Printf("           %s\n", d)
+			}
+			differences++
+		}
+	}
+	fmt.Printf("%d messages in %s, %d in %s, %d differences\n", len(real), realFile, len(sim), simFile, differences)
+	return differences
+}
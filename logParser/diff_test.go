@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+)
+
+// session builds log messages from keys: a cmd sent by the switch, "<" in
+// front for one sent by the gateway, "+<component>" behind for add_mapping.
+func session(keys ...string) []logMessage {
+	return sessionOf(keys)
+}
+
+func sessionOf(keys []string) []logMessage {
+	var messages []logMessage
+	for i, key := range keys {
+		m := logMessage{Line: i + 1}
+		if key[0] == '<' {
+			m.Server, key = true, key[1:]
+		}
+		m.Cmd = key
+		if len(key) > 1 && key[0] == '+' {
+			addMapping := &switchsim.SwitchAddMappingMessage{}
+			addMapping.Data.Component = key[1:]
+			m.Cmd, m.Message = "switch/add_mapping", addMapping
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func TestAlignSessions(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []logMessage
+		pairs []messagePair
+	}{
+		{"both empty", nil, nil, nil},
+		{"only real", session("check_in", "<check_in"), nil, []messagePair{{0, -1}, {1, -1}}},
+		{"only simulated", nil, session("check_in"), []messagePair{{-1, 0}}},
+		{
+			"same",
+			session("check_in", "<check_in", "config_msg"),
+			session("check_in", "<check_in", "config_msg"),
+			[]messagePair{{0, 0}, {1, 1}, {2, 2}},
+		},
+		{
+			"simulated is missing the tail",
+			session("check_in", "<check_in", "config_msg", "<config_msg"),
+			session("check_in", "<check_in"),
+			[]messagePair{{0, 0}, {1, 1}, {2, -1}, {3, -1}},
+		},
+		{
+			"simulated has an extra message in the middle",
+			session("check_in", "config_msg"),
+			session("check_in", "<check_in", "config_msg"),
+			[]messagePair{{0, 0}, {-1, 1}, {1, 2}},
+		},
+		{
+			"direction tells messages apart",
+			session("check_in"),
+			session("<check_in"),
+			[]messagePair{{0, -1}, {-1, 0}},
+		},
+		{
+			"add_mapping paired by component",
+			session("+VRF", "+PORT", "+PORT2VRF"),
+			session("+VRF", "+PORT2VRF"),
+			[]messagePair{{0, 0}, {1, -1}, {2, 1}},
+		},
+		{
+			"swapped messages",
+			session("check_in", "config_msg", "+VRF"),
+			session("config_msg", "check_in", "+VRF"),
+			[]messagePair{{0, -1}, {1, 0}, {-1, 1}, {2, 2}},
+		},
+	}
+	for _, test := range tests {
+		if pairs := alignSessions(test.a, test.b); !reflect.DeepEqual(pairs, test.pairs) {
+			t.Errorf("%s: pairs %v, want %v", test.name, pairs, test.pairs)
+		}
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   string
+		ignore []string
+		diffs  []string
+	}{
+		{"same", `{"a":1,"b":[1,{"c":"x"}]}`, `{"b":[1,{"c":"x"}],"a":1}`, nil, nil},
+		{"leaf", `{"a":1}`, `{"a":2}`, nil, []string{"a: 1 != 2"}},
+		{"nested", `{"data":{"agent":{"version":"3.1"}}}`, `{"data":{"agent":{"version":"3.2"}}}`, nil, []string{`data.agent.version: "3.1" != "3.2"`}},
+		{
+			"keys on one side",
+			`{"data":{"a":1,"b":2}}`, `{"data":{"b":2,"c":3}}`, nil,
+			[]string{"data.a: only in real: 1", "data.c: only in simulated: 3"},
+		},
+		{"type change", `{"a":{"b":1}}`, `{"a":[1]}`, nil, []string{`a: {"b":1} != [1]`}},
+		{"array element", `{"a":[1,2,3]}`, `{"a":[1,5,3]}`, nil, []string{"a[1]: 2 != 5"}},
+		{"longer real array", `{"a":[1,2,3]}`, `{"a":[1]}`, nil, []string{"a[1]: only in real: 2", "a[2]: only in real: 3"}},
+		{"longer simulated array", `{"a":[]}`, `{"a":[{"x":1}]}`, nil, []string{`a[0]: only in simulated: {"x":1}`}},
+		{
+			"objects in arrays",
+			`{"mappings":[{"dn":"a","oper":"add"},{"dn":"b"}]}`, `{"mappings":[{"dn":"a","oper":"del"},{"dn":"c"}]}`, nil,
+			[]string{`mappings[0].oper: "add" != "del"`, `mappings[1].dn: "b" != "c"`},
+		},
+		{
+			"ignored paths",
+			`{"data":{"modTs":"1","serial":"A","x":1},"switchId":"A"}`, `{"data":{"modTs":"2","x":2},"switchId":"B"}`,
+			[]string{"data.modTs", "data.serial", "switchId"},
+			[]string{"data.x: 1 != 2"},
+		},
+		{"ignored root", `{"a":1}`, `{"a":2}`, []string{""}, nil},
+	}
+	for _, test := range tests {
+		var a, b interface{}
+		if err := json.Unmarshal([]byte(test.a), &a); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.b), &b); err != nil {
+			t.Fatal(err)
+		}
+		ignore := make(map[string]bool)
+		for _, path := range test.ignore {
+			ignore[path] = true
+		}
+		if diffs := diffJSON("", a, b, ignore, nil); !reflect.DeepEqual(diffs, test.diffs) {
+			t.Errorf("%s: diffs %q, want %q", test.name, diffs, test.diffs)
+		}
+	}
+}
+
+// alignFullTable is alignSessions with the whole LCS table in memory.
+func alignFullTable(a []logMessage, b []logMessage) []messagePair {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if messageKey(a[i]) == messageKey(b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var pairs []messagePair
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case messageKey(a[i]) == messageKey(b[j]):
+			pairs = append(pairs, messagePair{i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			pairs = append(pairs, messagePair{i, -1})
+			i++
+		default:
+			pairs = append(pairs, messagePair{-1, j})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		pairs = append(pairs, messagePair{i, -1})
+	}
+	for ; j < len(b); j++ {
+		pairs = append(pairs, messagePair{-1, j})
+	}
+	return pairs
+}
+
+func TestAlignSessionsInBlocks(t *testing.T) {
+	keys := []string{"check_in", "<check_in", "config_msg", "<config_msg", "+VRF", "+PORT", "+PORT2VRF", "<add_mapping"}
+	r := rand.New(rand.NewSource(1))
+	randomSession := func(n int) []logMessage {
+		session := make([]string, n)
+		for i := range session {
+			session[i] = keys[r.Intn(len(keys))]
+		}
+		return sessionOf(session)
+	}
+	for _, n := range [][2]int{{0, 5}, {1, 1}, {7, 3}, {16, 16}, {17, 40}, {99, 80}, {250, 260}} {
+		a, b := randomSession(n[0]), randomSession(n[1])
+		if got, want := alignSessions(a, b), alignFullTable(a, b); !reflect.DeepEqual(got, want) {
+			t.Errorf("%d and %d messages: pairs %v, want %v", n[0], n[1], got, want)
+		}
+	}
+}
+
+func TestAlignLongSessions(t *testing.T) {
+	a := make([]string, 20000) // the whole table would take 3 GB
+	for i := range a {
+		a[i] = []string{"check_in", "<check_in", "+VRF", "<add_mapping"}[i%4]
+	}
+	b := append([]string{"config_msg"}, a[:len(a)-2]...)
+	pairs := alignSessions(sessionOf(a), sessionOf(b))
+	matched := 0
+	for _, p := range pairs {
+		if p.a >= 0 && p.b >= 0 {
+			matched++
+		}
+	}
+	if matched != len(a)-2 {
+		t.Errorf("%d messages matched, want %d", matched, len(a)-2)
+	}
+}
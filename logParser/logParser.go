@@ -2,22 +2,174 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
 )
 
-func main() {
-	filePath := "FD021422KGMlogInfo"
-	inFile, _ := os.Open(filePath)
+type logMessage struct {
+	Line    int
+	Cmd     string
+	Server  bool        // sent by the gateway
+	Raw     []byte      // unescaped JSON body
+	Message interface{} // one of the message types in message.go, or a generic map
+}
+
+// extractJSON returns the JSON body embedded in a log line, the object that
+// starts at its first brace, whatever follows it. The switch agent logs
+// payloads as escaped strings, so a body that isn't valid JSON as is gets
+// unquoted. Simulator session recordings carry plain JSON.
+func extractJSON(line string) ([]byte, bool) {
+	start := strings.Index(line, "{")
+	if start < 0 {
+		return nil, false
+	}
+	body := line[start:]
+	if raw, ok := firstJSON(body); ok {
+		return raw, true
+	}
+	if !strings.Contains(body, "\\\"") {
+		return nil, false
+	}
+	// Read the body as the inside of a JSON string, up to its closing quote.
+	var unescaped string
+	if err := json.NewDecoder(strings.NewReader("\"" + body + "\"")).Decode(&unescaped); err != nil {
+		return nil, false
+	}
+	return firstJSON(unescaped)
+}
+
+// firstJSON returns the JSON object s starts with.
+func firstJSON(s string) ([]byte, bool) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(s)).Decode(&raw); err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+// decodeMessage picks the message type from the cmd field. Messages carrying a
+// responseCode come from the gateway, everything else from the switch.
+func decodeMessage(raw []byte) (string, bool, interface{}, error) {
+	var peek struct {
+		Cmd          string `json:"cmd"`
+		ResponseCode *int   `json:"responseCode"`
+	}
+	if err := json.Unmarshal(raw, &peek); err != nil {
+		return "", false, nil, err
+	}
+	var message interface{}
+	switch {
+	case peek.ResponseCode != nil && peek.Cmd == "switch/config_msg":
+		message = &switchsim.ServerConfigMessage{}
+	case peek.ResponseCode != nil:
+		message = &switchsim.ServerMessage{}
+	case peek.Cmd == "switch/check_in":
+		message = &switchsim.SwitchCheckInMessage{}
+	case peek.Cmd == "switch/config_msg":
+		message = &switchsim.SwitchConfigMessage{}
+	case peek.Cmd == "switch/add_mapping":
+		message = &switchsim.SwitchAddMappingMessage{}
+	default:
+		message = &map[string]interface{}{}
+	}
+	if err := json.Unmarshal(raw, message); err != nil {
+		return peek.Cmd, false, nil, err
+	}
+	return peek.Cmd, peek.ResponseCode != nil, message, nil
+}
+
+func parseLog(fileName string) ([]logMessage, error) {
+	inFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
 	defer inFile.Close()
 	scanner := bufio.NewScanner(inFile)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // add_mapping lines get long
 	scanner.Split(bufio.ScanLines)
-	tmp := make([]string, 5)
-	i := 0
-	for scanner.Scan() {
-		tmp[i] = strings.Replace(scanner.Text(), "\\", "", -1)
-		i++
+	var messages []logMessage
+	for n := 1; scanner.Scan(); n++ {
+		raw, ok := extractJSON(scanner.Text())
+		if !ok {
+			continue
+		}
+		cmd, server, message, err := decodeMessage(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: can't decode %s message: %v\n", fileName, n, cmd, err)
+			continue
+		}
+		messages = append(messages, logMessage{Line: n, Cmd: cmd, Server: server, Raw: raw, Message: message})
+	}
+	return messages, scanner.Err()
+}
+
+func main() {
+	inFile := flag.String("in", "FD021422KGMlogInfo", "switch agent log or simulator session recording to parse")
+	cmd := flag.String("cmd", "", "only print messages with this cmd, e.g. switch/add_mapping")
+	compact := flag.Bool("compact", false, "re-emit one clean JSON message per line instead of pretty-printing")
+	importName := flag.String("import", "", "save the captured switch messages as a switch profile with this name")
+	outFile := flag.String("out", "", "profile file written by -import (default <name>.profile.json)")
+	diffFile := flag.String("diff", "", "simulator session to compare against the -in log")
+	ignore := flag.String("ignore", "switchId,data.switch_name,data.systemUpTime,data.modTs", "comma separated JSON paths -diff doesn't compare")
+	flag.Parse()
+
+	messages, err := parseLog(*inFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't parse %s: %v\n", *inFile, err)
+		os.Exit(1)
+	}
+	if *diffFile != "" {
+		simMessages, err := parseLog(*diffFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't parse %s: %v\n", *diffFile, err)
+			os.Exit(1)
+		}
+		ignored := make(map[string]bool)
+		for _, path := range strings.Split(*ignore, ",") {
+			if path != "" {
+				ignored[path] = true
+			}
+		}
+		if diffSessions(*inFile, messages, *diffFile, simMessages, ignored) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *importName != "" {
+		if *outFile == "" {
+			*outFile = *importName + ".profile.json"
+		}
+		if err = importProfile(*importName, messages, *outFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't import %s: %v\n", *inFile, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Switch profile %s written to %s\n", *importName, *outFile)
+		return
+	}
+	for _, m := range messages {
+		if *cmd != "" && m.Cmd != *cmd {
+			continue
+		}
+		// The original text, the message types don't model every field.
+		var out bytes.Buffer
+		if *compact {
+			err = json.Compact(&out, m.Raw)
+		} else {
+			err = json.Indent(&out, m.Raw, "", "  ")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: can't format %s message: %v\n", *inFile, m.Line, m.Cmd, err)
+			continue
+		}
+		if !*compact {
+			fmt.Printf("# %s:%d %s\n", *inFile, m.Line, m.Cmd)
+		}
+		fmt.Println(out.String())
 	}
-	fmt.Printf(tmp[1] + "\n")
 }
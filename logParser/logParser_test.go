@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		body string // empty if the line has no message
+	}{
+		{"plain", `{"cmd":"switch/check_in"}`, `{"cmd":"switch/check_in"}`},
+		{"escaped", `{\"cmd\":\"switch/check_in\",\"data\":{\"a\":\"b\"}}`, `{"cmd":"switch/check_in","data":{"a":"b"}}`},
+		{"log prefix", `I0101 12:00:00 agent: sent {"cmd":"x","data":{}}`, `{"cmd":"x","data":{}}`},
+		{"trailing braces", `sent {"cmd":"x","data":{"n":1}} (ctx {id 7})`, `{"cmd":"x","data":{"n":1}}`},
+		{"escaped with trailing braces", `got {\"cmd\":\"x\",\"data\":{}} in {3ms}`, `{"cmd":"x","data":{}}`},
+		{"escaped inside a quoted string", `msg="{\"cmd\":\"x\"}" level=info {y}`, `{"cmd":"x"}`},
+		{"unmodeled fields kept", `{"cmd":"x","unknown":{"deep":[1,2]}}`, `{"cmd":"x","unknown":{"deep":[1,2]}}`},
+		{"no JSON", `agent started`, ``},
+		{"braces that aren't JSON", `state {up} for {3s}`, ``},
+		{"truncated", `{"cmd":"x","data":{`, ``},
+	}
+	for _, test := range tests {
+		body, ok := extractJSON(test.line)
+		if ok != (test.body != "") || string(body) != test.body {
+			t.Errorf("%s: extractJSON(%q) = %q, %v, want %q", test.name, test.line, body, ok, test.body)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+)
+
+// importProfile takes the first check_in, config_msg and the add_mapping
+// messages up to the next check_in that the switch sent, and saves them with
+// the switch's serial and name replaced by the simulator's placeholders.
+func importProfile(name string, messages []logMessage, fileName string) error {
+	profile := switchsim.SwitchProfile{Name: name}
+	var captured [][]byte
+	for _, m := range messages {
+		if m.Server {
+			continue
+		}
+		if m.Cmd == "switch/check_in" {
+			if profile.CheckIn != nil {
+				break // the switch reconnected, keep the first session only
+			}
+			checkIn := m.Message.(*switchsim.SwitchCheckInMessage)
+			profile.Serial = checkIn.SwitchID
+			profile.SwitchName = checkIn.Data.SwitchName
+			profile.CheckIn = m.Raw
+			continue
+		}
+		if profile.CheckIn == nil {
+			continue
+		}
+		switch m.Cmd {
+		case "switch/config_msg":
+			if profile.Config == nil {
+				profile.Config = m.Raw
+			}
+		case "switch/add_mapping":
+			captured = append(captured, m.Raw)
+		}
+	}
+	if profile.CheckIn == nil {
+		return errors.New("no switch/check_in message found")
+	}
+	if profile.Config == nil {
+		return errors.New("no switch/config_msg message found after switch/check_in")
+	}
+
+	var placeholders []string
+	if profile.Serial != "" {
+		placeholders = append(placeholders, profile.Serial, switchsim.ProfileSerial)
+	}
+	if profile.SwitchName != "" {
+		placeholders = append(placeholders, profile.SwitchName, switchsim.ProfileSwitchName)
+	}
+	r := strings.NewReplacer(placeholders...)
+	profile.CheckIn = json.RawMessage(r.Replace(string(profile.CheckIn)))
+	profile.Config = json.RawMessage(r.Replace(string(profile.Config)))
+	for _, m := range captured {
+		profile.AddMappings = append(profile.AddMappings, json.RawMessage(r.Replace(string(m))))
+	}
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+	"github.com/golang/glog"
+)
+
+// adminServer is the HTTP API test harnesses use to drive a running simulator:
+//
+//	GET    /switches                      list switches
+//	POST   /switches                      spawn switches, body {"count": n, "role": ..., "capability": ..., "switchName": ..., "ip": ...}
+//	GET    /switches/<serial>             show a switch
+//	GET    /switches/<serial>/flows       preview the switch's first flows, ?n=20&traffic=web=3,scan=1&seed=1 override its mix and seed
+//	DELETE /switches/<serial>             disconnect and remove a switch
+//	POST   /switches/<serial>/disconnect  close the websocket
+//	POST   /switches/<serial>/reconnect   register and open a new websocket
+//	POST   /switches/<serial>/checkin     send a switch/check_in
+//	POST   /switches/<serial>/send        send the JSON message in the body as is
+//	POST   /switches/<serial>/mappings    change the inventory, body {"component": "VRF", "mapping": {"oper": "add", "dn": ...}}
+//	GET    /assignments                   compare the collector assignments of all switches
+//	GET    /memory                        memory of the fleet and per switch
+type adminServer struct {
+	fleet *switchsim.Fleet
+}
+
+func (a *adminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	if path == "assignments" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, a.fleet.Assignments())
+		return
+	}
+	if path == "memory" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, a.fleet.Memory())
+		return
+	}
+	if parts[0] != "switches" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			a.listSwitches(w)
+		case http.MethodPost:
+			a.spawnSwitches(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	s := a.fleet.Get(parts[1])
+	if s == nil {
+		http.Error(w, "no switch "+parts[1], http.StatusNotFound)
+		return
+	}
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.Status())
+		case http.MethodDelete:
+			a.fleet.Remove(s.Serial())
+			glog.Infof(s.Serial() + ": removed by admin API\n")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if parts[2] == "flows" && r.Method == http.MethodGet {
+		a.previewFlows(w, r, s)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch parts[2] {
+	case "disconnect":
+		s.Disconnect()
+	case "reconnect":
+		s.Disconnect()
+		a.fleet.Start(s)
+	case "checkin":
+		if !s.Send("switch/check_in", s.CheckInMessage()) {
+			http.Error(w, s.Serial()+" is not connected", http.StatusConflict)
+			return
+		}
+	case "send":
+		a.sendMessage(w, r, s)
+		return
+	case "mappings":
+		a.changeMapping(w, r, s)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+func (a *adminServer) listSwitches(w http.ResponseWriter) {
+	switches := a.fleet.List()
+	statuses := make([]switchsim.Status, len(switches))
+	for i, s := range switches {
+		statuses[i] = s.Status()
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (a *adminServer) spawnSwitches(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Count      int    `json:"count"`
+		Role       string `json:"role"`
+		Capability string `json:"capability"`
+		SwitchName string `json:"switchName"`
+		IP         string `json:"ip"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Count < 1 {
+		request.Count = 1
+	}
+	var statuses []switchsim.Status
+	for i := 0; i < request.Count; i++ {
+		placement := switchsim.Placement{HostName: request.SwitchName, Role: request.Role, Capability: request.Capability}
+		if i == 0 {
+			placement.IP = request.IP
+		}
+		s, err := a.fleet.Add(placement)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		glog.Infof(s.Serial() + ": spawned by admin API\n")
+		go a.fleet.Start(s)
+		statuses = append(statuses, s.Status())
+	}
+	writeJSON(w, http.StatusCreated, statuses)
+}
+
+func (a *adminServer) sendMessage(w http.ResponseWriter, r *http.Request, s *switchsim.Switch) {
+	message, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var switchMessage switchsim.SwitchMessage // for the cmd value
+	if err = json.Unmarshal(message, &switchMessage); err != nil {
+		http.Error(w, "message is not JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.Send(switchMessage.Cmd, message) {
+		http.Error(w, s.Serial()+" is not connected", http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+func (a *adminServer) changeMapping(w http.ResponseWriter, r *http.Request, s *switchsim.Switch) {
+	var request struct {
+		Component string            `json:"component"`
+		Mapping   switchsim.Mapping `json:"mapping"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message, err := s.ChangeMapping(request.Component, request.Mapping)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A disconnected switch reports the change with its inventory when it reconnects.
+	s.Send("switch/add_mapping", message)
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (a *adminServer) previewFlows(w http.ResponseWriter, r *http.Request, s *switchsim.Switch) {
+	query := r.URL.Query()
+	n := 20
+	if query.Get("n") != "" {
+		var err error
+		if n, err = strconv.Atoi(query.Get("n")); err != nil || n < 0 || n > 10000 {
+			http.Error(w, "n must be a number from 0 to 10000", http.StatusBadRequest)
+			return
+		}
+	}
+	generator := s.FlowGenerator()
+	if query.Get("traffic") != "" || query.Get("seed") != "" {
+		mix, seed := s.TrafficMix()
+		var err error
+		if query.Get("traffic") != "" {
+			if mix, err = switchsim.ParseTrafficMix(query.Get("traffic")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if query.Get("seed") != "" {
+			if seed, err = strconv.ParseInt(query.Get("seed"), 10, 64); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		generator = s.NewFlowGenerator(mix, seed)
+	}
+	now := time.Now()
+	flows := make([]switchsim.Flow, n)
+	for i := range flows {
+		flows[i] = generator.Next(now)
+	}
+	writeJSON(w, http.StatusOK, flows)
+}
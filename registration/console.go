@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+)
+
+const consoleHelp = `commands:
+  list                      list switches
+  attach <serial|name>      take control of a switch, its messages are shown live
+  checkin                   send switch/check_in built from the switch's current state
+  config                    send switch/config_msg
+  mappings                  send switch/add_mapping for every inventory component
+  send <json>               send a message as typed
+  load <file>               send the JSON messages in a file, one per line or a single one
+  disconnect | reconnect    close or reopen the websocket
+  detach                    stop showing the switch's messages
+  quit                      stop the simulator
+`
+
+// console lets a user drive one simulated switch by hand, in place of a wscat
+// session without the switch's TLS and registration setup.
+type console struct {
+	fleet    *switchsim.Fleet
+	in       io.Reader
+	out      io.Writer
+	attached *switchsim.Switch
+	unwatch  func()
+	mu       sync.Mutex // out is written by the prompt and by the switch's watcher
+}
+
+func (c *console) printf(format string, a ...interface{}) {
+	c.mu.Lock()
+	fmt.Fprintf(c.out, format, a...)
+	c.mu.Unlock()
+}
+
+func (c *console) attach(name string) {
+	var s *switchsim.Switch
+	for _, candidate := range c.fleet.List() {
+		if candidate.Serial() == name || candidate.Identity().HostName == name {
+			s = candidate
+			break
+		}
+	}
+	if s == nil {
+		c.printf("no switch %s\n", name)
+		return
+	}
+	c.detach()
+	c.attached = s
+	c.unwatch = s.Watch(func(direction string, message []byte) {
+		arrow := "->"
+		if direction == "recv" {
+			arrow = "<-"
+		}
+		c.printf("%s %s %s\n", s.Identity().HostName, arrow, message)
+	})
+	c.printf("attached to %s (%s), %s\n", s.Serial(), s.Identity().HostName, s.State())
+}
+
+func (c *console) detach() {
+	if c.unwatch != nil {
+		c.unwatch()
+		c.unwatch = nil
+	}
+	c.attached = nil
+}
+
+// sendJSON sends a message typed or loaded by the user, taking the cmd from
+// the message itself.
+func (c *console) sendJSON(message []byte) {
+	var switchMessage switchsim.SwitchMessage // for the cmd value
+	if err := json.Unmarshal(message, &switchMessage); err != nil {
+		c.printf("not a JSON message: %v\n", err)
+		return
+	}
+	if !c.attached.Send(switchMessage.Cmd, message) {
+		c.printf("%s is not connected\n", c.attached.Serial())
+	}
+}
+
+func (c *console) load(fileName string) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		c.printf("can't read %s: %v\n", fileName, err)
+		return
+	}
+	if json.Valid(data) {
+		c.sendJSON(data)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			c.sendJSON([]byte(line))
+		}
+	}
+}
+
+func (c *console) run() {
+	c.printf("switch simulator console, type help for commands\n")
+	scanner := bufio.NewScanner(c.in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for c.printf("> "); scanner.Scan(); c.printf("> ") {
+		line := strings.TrimSpace(scanner.Text())
+		command, argument := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			command, argument = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch command {
+		case "":
+			continue
+		case "help":
+			c.printf("%s", consoleHelp)
+			continue
+		case "quit", "exit":
+			c.detach()
+			return
+		case "list":
+			for _, s := range c.fleet.List() {
+				c.printf("%s %-24s %-15s %s\n", s.Serial(), s.Identity().HostName, s.Identity().IP, s.State())
+			}
+			continue
+		case "attach":
+			c.attach(argument)
+			continue
+		}
+		if c.attached == nil {
+			c.printf("attach to a switch first\n")
+			continue
+		}
+		s := c.attached
+		switch command {
+		case "detach":
+			c.detach()
+		case "checkin":
+			c.sendJSON(s.CheckInMessage())
+		case "config":
+			c.sendJSON(s.ConfigMessage())
+		case "mappings":
+			for _, m := range s.AddMappingMessages() {
+				c.sendJSON(m)
+			}
+		case "send":
+			c.sendJSON([]byte(argument))
+		case "load":
+			c.load(argument)
+		case "disconnect":
+			s.Disconnect()
+		case "reconnect":
+			s.Disconnect()
+			c.fleet.Start(s)
+		default:
+			c.printf("unknown command %s, type help for commands\n", command)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+	"github.com/gorilla/websocket"
+)
+
+// echoGateway answers every switch message with a response of the same cmd.
+func echoGateway(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/switch_register", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/switch_wss", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var m switchsim.SwitchMessage
+			json.Unmarshal(message, &m)
+			conn.WriteMessage(websocket.BinaryMessage, []byte(fmt.Sprintf(`{"cmd":%q,"responseCode":200}`, m.Cmd)))
+		}
+	})
+	gateway := httptest.NewTLSServer(mux)
+	t.Cleanup(gateway.Close)
+	return strings.TrimPrefix(gateway.URL, "https://")
+}
+
+func TestConsole(t *testing.T) {
+	identities, err := switchsim.NewIdentityGenerator(1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fleet := switchsim.NewFleet(context.Background(), identities, switchsim.WithGateway(echoGateway(t)))
+	s, err := fleet.Add(switchsim.Placement{HostName: "leaf1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fleet.Start(s)
+	defer fleet.Shutdown(time.Second)
+
+	in, script := io.Pipe()
+	var out bytes.Buffer
+	c := &console{fleet: fleet, in: in, out: &out}
+	done := make(chan struct{})
+	go func() {
+		c.run()
+		close(done)
+	}()
+	// Each command is typed once the console has printed what the one
+	// before it should.
+	steps := []struct {
+		command string
+		want    string
+	}{
+		{"help", "take control of a switch"},
+		{"checkin", "attach to a switch first"},
+		{"attach leaf9", "no switch leaf9"},
+		{"list", s.Serial() + " leaf1"},
+		{"attach leaf1", "attached to " + s.Serial() + " (leaf1), connected"},
+		{"checkin", `leaf1 <- {"cmd":"switch/check_in","responseCode":200}`},
+		{`send {"cmd":"switch/config_msg","switchId":"x"}`, `leaf1 -> {"cmd":"switch/config_msg","switchId":"x"}`},
+		{"send {bad", "not a JSON message"},
+		{"reboot", "unknown command reboot"},
+		{"detach", "> "},
+	}
+	for _, step := range steps {
+		c.mu.Lock()
+		from := out.Len()
+		c.mu.Unlock()
+		io.WriteString(script, step.command+"\n")
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			c.mu.Lock()
+			printed := out.String()[from:]
+			c.mu.Unlock()
+			if strings.Contains(printed, step.want) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s printed %q, want %q", step.command, printed, step.want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	io.WriteString(script, "quit\n")
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("quit didn't stop the console")
+	}
+}
@@ -1,278 +1,239 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"flag"
-	"io/ioutil"
 	"net/http"
-	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
 	"github.com/golang/glog"
-	"github.com/gorilla/websocket"
 )
 
-type switchWebHandler struct {
-	switchName         string
-	gatewayRegisterURL url.URL
-	gatewayWssURL      url.URL
-	httpClient         *http.Client
-	websocketDialer    websocket.Dialer
-}
-
-type gateWay struct {
-	IP string
-}
-
-func (gateway *gateWay) getGatewayRegisterIP() string {
-	return gateway.IP
-}
-
-func (gateway *gateWay) getGatewayWebsocketIP() string {
-	return gateway.IP
-}
-
-type channelMessage struct {
-	Cmd     string
-	Message []byte
-}
-
-func NewSwitchWebHandler(gateway *gateWay, switchName string) *switchWebHandler {
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
+func main() {
+	profileFile := flag.String("profile", "", "switch profile written by logParser -import (default: built-in n9k-standalone-leaf)")
+	recordDir := flag.String("record", "", "record each switch's websocket session to <dir>/<switch>.session")
+	var plan switchsim.UpgradePlan
+	flag.StringVar(&plan.AgentVersion, "upgradeAgentVersion", "", "agentVersion switches report after a rolling upgrade")
+	flag.StringVar(&plan.ImageName, "upgradeImageName", "", "imageName switches report after a rolling upgrade")
+	flag.DurationVar(&plan.Start, "upgradeAfter", 5*time.Minute, "delay after registration before the rolling upgrade starts")
+	flag.IntVar(&plan.BatchSize, "upgradeBatchSize", 1, "switches upgraded at the same time")
+	flag.DurationVar(&plan.Interval, "upgradeInterval", time.Minute, "delay between upgrade batches")
+	flag.DurationVar(&plan.RebootTime, "rebootTime", 3*time.Minute, "how long an upgrading switch stays down, in virtual time")
+	timeFactor := flag.Float64("timeFactor", 1, "how much faster than real time the switches' clocks run")
+	upTime := flag.Duration("upTime", 0, "systemUpTime switches start with (default: the profile's)")
+	topologyFile := flag.String("topology", "", "fabric topology file describing the switches to simulate")
+	numberOfSwitches := flag.Int("switches", 1, "number of switches to simulate without a topology")
+	seed := flag.Int64("seed", 1, "seed for switch serials, MACs and everything else the simulator randomizes")
+	mgmtCIDR := flag.String("mgmtCIDR", "", "subnet switches get management IPs from, e.g. 10.1.0.0/16")
+	faultsFile := flag.String("faults", "", "fault injection config for websocket messages and registrations")
+	adminAddr := flag.String("admin", "", "address of the admin API, e.g. :8080; the simulator keeps running until killed when set")
+	gateway := flag.String("gateway", "172.21.92.97", "host[:port] of the gateways switches register with, separated by commas; register/websocket for separate endpoints, e.g. gw1,gw2:443/gw2:8443,[2001:db8::1]:443")
+	gatewayAssignment := flag.String("gatewayAssignment", switchsim.AssignRoundRobin, "how switches are spread over the gateways: roundRobin or hash (of the serial)")
+	transport := switchsim.DefaultTransport
+	flag.StringVar(&transport.Proxy, "proxy", "", "proxy to reach the gateways through, http://host:port (HTTP CONNECT) or socks5://host:port")
+	flag.DurationVar(&transport.ConnectTimeout, "connectTimeout", transport.ConnectTimeout, "timeout of TCP connects to the gateway or proxy")
+	flag.DurationVar(&transport.HandshakeTimeout, "handshakeTimeout", transport.HandshakeTimeout, "timeout of the TLS and websocket handshakes")
+	flag.DurationVar(&transport.ReadTimeout, "readTimeout", 0, "timeout of the registration response, and how long a websocket may go without a gateway message or an answer to the pings sent every half of it (default: none)")
+	flag.DurationVar(&transport.WriteTimeout, "writeTimeout", 0, "timeout of every websocket write, a stalled gateway fails the write (default: none)")
+	flag.IntVar(&transport.ReadBufferSize, "readBufferSize", 0, "websocket read buffer size in bytes (default 4096)")
+	flag.IntVar(&transport.WriteBufferSize, "writeBufferSize", 0, "websocket write buffer size in bytes (default 4096)")
+	sharedWriteBuffers := flag.Bool("sharedWriteBuffers", false, "share websocket write buffers between the switches instead of one per websocket")
+	flag.BoolVar(&transport.Compression, "compression", false, "offer the gateways permessage-deflate")
+	flag.Int64Var(&transport.MaxMessageSize, "maxMessageSize", 0, "largest gateway message in bytes, larger ones close the websocket (default: no limit)")
+	sourceIP := flag.String("sourceIP", "", "local address switches connect to the gateways from")
+	sourceIPs := flag.String("sourceIPs", "", "local addresses to give each switch one of, to connect to the gateways from, separated by commas: IPs, CIDRs, first-last ranges or iface:<name>, e.g. 10.1.0.10-10.1.0.99,iface:dummy0")
+	resolveGateways := flag.Bool("resolveGateways", false, "treat every address a gateway's DNS name resolves to as a gateway of its own")
+	interactive := flag.Bool("console", false, "drive switches by hand from an interactive console on stdin")
+	reportFile := flag.String("report", "", "write a JSON report with each switch's final state and counters to this file on exit")
+	closePolicyFlag := flag.String("closePolicy", "", "what switches do when the gateway closes their websocket or goes quiet for -readTimeout, code or class (normal, goingAway, policyViolation, abnormal, timeout, other) = giveUp, reconnect or reregister, e.g. goingAway=reconnect,abnormal=reregister (default: giveUp)")
+	reconnectDelay := flag.Duration("reconnectDelay", time.Second, "wait before reconnecting after the gateway closed a websocket")
+	framing := flag.String("framing", "", "websocket frames switches send their messages in, binary or text (default: the profile's, binary if it has none)")
+	strictFraming := flag.Bool("strictFraming", false, "close the websocket when the gateway answers in other frames than the switch's, or not in UTF-8")
+	validate := flag.String("validate", "", "check gateway messages against their schema: report counts violations, strict also closes the websocket")
+	traffic := flag.String("traffic", "web", "traffic profiles of the switches' flows with weights, web, eastWest, elephant or scan, e.g. web=3,eastWest=5,scan=1")
+	exportRate := flag.Int("exportRate", 0, "flows each switch exports a second to the collectors of its config_msg (default: no export)")
+	var shape switchsim.ExportShape
+	flag.StringVar(&shape.Burst, "burst", "", "export burst mode: micro sends burstFactor times burstLength of flows at once every burstEvery, spike exports burstFactor times the rate for burstLength, burstEvery after the export starts")
+	flag.DurationVar(&shape.BurstEvery, "burstEvery", 10*time.Second, "interval between microbursts, or delay before the spike")
+	flag.DurationVar(&shape.BurstLength, "burstLength", 100*time.Millisecond, "flows of how long a microburst sends, or how long the spike lasts")
+	flag.Float64Var(&shape.BurstFactor, "burstFactor", 10, "rate multiplier of a burst")
+	flag.DurationVar(&shape.Ramp, "exportRamp", 0, "ramp the fleet's export from nothing to -exportRate over this long")
+	flag.Float64Var(&shape.PacketsPerSecond, "exportPps", 0, "limit of the export datagrams all switches send a second (default: no limit)")
+	flag.Float64Var(&shape.Mbps, "exportMbps", 0, "limit of the export bandwidth of all switches in Mbps (default: no limit)")
+	ledgerFile := flag.String("ledger", "", "write every exported flow to this file for ledgerVerify")
+	shutdownTimeout := flag.Duration("shutdownTimeout", 5*time.Second, "how long to wait for in-flight responses and close handshakes on exit")
+	flag.Parse()
+	flag.Lookup("logtostderr").Value.Set("true")
+	profile := &switchsim.DefaultProfile
+	if *profileFile != "" {
+		var err error
+		profile, err = switchsim.LoadProfile(*profileFile)
+		if err != nil {
+			glog.Fatalf("Can't load switch profile %s: %v\n", *profileFile, err)
+		}
 	}
-	websocketDialer := websocket.Dialer{
-		HandshakeTimeout: 60 * time.Minute,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+	glog.Infof("Using switch profile %s\n", profile.Name)
+	placements := make([]switchsim.Placement, *numberOfSwitches) // switches as captured in the profile
+	if *topologyFile != "" {
+		t, err := switchsim.LoadTopology(*topologyFile)
+		if err != nil {
+			glog.Fatalf("Can't load topology %s: %v\n", *topologyFile, err)
+		}
+		placements = t.Placements()
 	}
-	return &switchWebHandler{
-		switchName:         switchName,
-		gatewayRegisterURL: url.URL{Scheme: "https", Host: gateway.getGatewayRegisterIP(), Path: "/switch_register"},
-		gatewayWssURL:      url.URL{Scheme: "wss", Host: gateway.getGatewayWebsocketIP(), Path: "/switch_wss"},
-		httpClient:         httpClient,
-		websocketDialer:    websocketDialer,
+	identities, err := switchsim.NewIdentityGenerator(*seed, *mgmtCIDR)
+	if err != nil {
+		glog.Fatalf("Can't parse -mgmtCIDR %s: %v\n", *mgmtCIDR, err)
 	}
-}
-
-func (s *switchWebHandler) sender(conn *websocket.Conn, toSender chan channelMessage, senderToValidator chan string, allToMainLoop chan string) {
-	for {
-		m := <-toSender
-		conn.WriteMessage(websocket.BinaryMessage, m.Message)
-
-		glog.Infof(s.switchName + ": " + m.Cmd + " message sent\n")
-		switch m.Cmd {
-		case "switch/check_in":
-			senderToValidator <- m.Cmd
-		case "switch/config_msg":
-			senderToValidator <- m.Cmd
-		case "switch/add_mapping":
-			senderToValidator <- m.Cmd
-		default: //todo: add other response to server's command
+	var faults *switchsim.FaultConfig
+	if *faultsFile != "" {
+		if faults, err = switchsim.LoadFaultConfig(*faultsFile); err != nil {
+			glog.Fatalf("Can't load fault config %s: %v\n", *faultsFile, err)
 		}
 	}
-}
-
-func (s *switchWebHandler) receiver(conn *websocket.Conn, receiverToValidator chan string, allToMainLoop chan string) {
-	for {
-		messageType, message, err := conn.ReadMessage()
-		if err != nil {
-			if messageType == websocket.CloseMessage {
-				glog.Infof(s.switchName + ": websocket.Close() message received, close webocket gracefully\n")
-				allToMainLoop <- s.switchName
-				return
-			} else {
-				glog.Errorf(s.switchName+": Can't read websocket message: %v\n", err)
-				//todo: send websocket.Close() message to gateway before conn.Close()
-				allToMainLoop <- s.switchName
-				return
-			}
-		}
-		var serverMessage ServerMessage //for the cmd value
-		err = json.Unmarshal(message, &serverMessage)
-		if err != nil {
-			glog.Errorf(s.switchName+": Can't unmarshal websocket message: %v\n", err)
-			allToMainLoop <- s.switchName //todo: send websocket.Close() message to gateway before conn.CLose()
-			return
+	policy, err := switchsim.ParseClosePolicy(*closePolicyFlag)
+	if err != nil {
+		glog.Fatalf("Can't parse -closePolicy: %v\n", err)
+	}
+	switch *validate {
+	case switchsim.ValidateOff, switchsim.ValidateReport, switchsim.ValidateStrict:
+	default:
+		glog.Fatalf("Unknown -validate mode %s\n", *validate)
+	}
+	if *framing != "" {
+		if _, err = switchsim.ParseFraming(*framing); err != nil {
+			glog.Fatalf("Can't parse -framing: %v\n", err)
 		}
-		glog.Infof(s.switchName + ": Server's " + serverMessage.Cmd + " message received\n")
-		switch serverMessage.Cmd {
-		case "switch/check_in":
-			receiverToValidator <- serverMessage.Cmd
-		case "switch/config_msg":
-			receiverToValidator <- serverMessage.Cmd
-			/*var serverConfigMessage ServerConfigMessage
-			err = json.Unmarshal(message, &serverConfigMessage)
-			if err != nil {
-				glog.Errorf(s.switchName+": Can't unmarshal switch/config_msg message: %v\n", err)
-				allToMainLoop <- s.switchName
-				return
-			}*/
-			fileName := s.switchName + "ConfigMessage"
-			err = ioutil.WriteFile(fileName, message, 0644)
-			if err != nil {
-				glog.Errorf(s.switchName+": Error writing configMessage to file: %v\n", err)
-				allToMainLoop <- s.switchName
-				return
-			}
-		case "switch/add_mapping":
-			receiverToValidator <- serverMessage.Cmd
-		default: //todo: add other server's command --> generate response -->forward to sender
+	}
+	gateways, err := switchsim.ParseGatewayPool(*gateway, *gatewayAssignment)
+	if err != nil {
+		glog.Fatalf("Can't parse -gateway: %v\n", err)
+	}
+	if *resolveGateways {
+		if err = gateways.Resolve(context.Background()); err != nil {
+			glog.Fatalf("Can't resolve gateways: %v\n", err)
 		}
 	}
-}
-
-func (s *switchWebHandler) validator(senderToValidator chan string, receiverToValidator chan string, allToMainLoop chan string) {
-	for {
-		ms := <-senderToValidator
-		timeOut := make(chan bool)
-		go func() {
-			time.Sleep(30 * time.Second)
-			timeOut <- true
-		}()
-		for f := true; f == true; {
-			select {
-			case mr := <-receiverToValidator:
-				if mr == ms {
-					glog.Infof(s.switchName + ": request " + ms + " and response " + mr + " matched\n")
-					f = false
-					break
-				} else {
-					glog.Infof(s.switchName + ": Validation error! request " + ms + " and response " + mr + " unmatched\n")
-					allToMainLoop <- s.switchName
-					return
-				}
-			case <-timeOut:
-				glog.Infof(s.switchName + ": Timeout waiting for " + ms + " response\n")
-				allToMainLoop <- s.switchName
-				return
-			default:
-			}
+	if *sharedWriteBuffers {
+		transport.WriteBufferPool = &sync.Pool{}
+	}
+	if err = transport.Validate(); err != nil {
+		glog.Fatalf("Bad transport settings: %v\n", err)
+	}
+	var sourceIPPool *switchsim.SourceIPPool
+	if *sourceIPs != "" {
+		if *sourceIP != "" {
+			glog.Fatalf("Give either -sourceIP or -sourceIPs\n")
+		}
+		if sourceIPPool, err = switchsim.ParseSourceIPPool(*sourceIPs); err != nil {
+			glog.Fatalf("Can't parse -sourceIPs: %v\n", err)
+		}
+		if sourceIPPool.Len() < len(placements) {
+			glog.Fatalf("-sourceIPs has %d addresses for %d switches\n", sourceIPPool.Len(), len(placements))
 		}
 	}
-}
-
-func (s *switchWebHandler) marshalMessage(cmd string, message interface{}) ([]byte, bool) {
-	jsonMessage, err := json.Marshal(message)
+	mix, err := switchsim.ParseTrafficMix(*traffic)
 	if err != nil {
-		glog.Errorf(s.switchName+": Can't marshal "+cmd+" message: %v\n", err)
-		return nil, false
-	} else {
-		return jsonMessage, true
+		glog.Fatalf("Can't parse -traffic: %v\n", err)
 	}
-}
-
-func (s *switchWebHandler) WebSocketRequest(allToMainLoop chan string) bool { //return false if websocket creation fails
-	conn, _, err := s.websocketDialer.Dial(s.gatewayWssURL.String(), nil)
-	if err != nil {
-		glog.Errorf(s.switchName+": Can't make websocket: %v\n", err)
-		return false
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	options := []switchsim.Option{
+		switchsim.WithGatewayPool(gateways),
+		switchsim.WithTransport(transport),
+		switchsim.WithSourceIP(*sourceIP),
+		switchsim.WithSourceIPPool(sourceIPPool),
+		switchsim.WithProfile(profile),
+		switchsim.WithClock(switchsim.NewVirtualClock(*timeFactor)),
+		switchsim.WithUpTime(*upTime),
+		switchsim.WithClosePolicy(policy, *reconnectDelay),
+		switchsim.WithValidation(*validate),
+		switchsim.WithFraming(*framing, *strictFraming),
+		switchsim.WithTraffic(mix, *seed),
 	}
-	glog.Infof(s.switchName + ": Websocket established\n")
-	//conn.SetReadDeadline(time.Now().Add(time.Minute))
-
-	toSender := make(chan channelMessage, 10)
-	senderToValidator := make(chan string, 10)
-	receiverToValidator := make(chan string, 10)
-
-	go s.sender(conn, toSender, senderToValidator, allToMainLoop)
-	go s.receiver(conn, receiverToValidator, allToMainLoop)
-	go s.validator(senderToValidator, receiverToValidator, allToMainLoop)
-
-	cm := channelMessage{"switch/check_in", s.getCheckInMessage()}
-	glog.Infof(s.switchName + ": forwarding switch/check_in message to sender\n")
-	toSender <- cm
-	cm = channelMessage{"switch/config_msg", s.getConfigMessage()}
-	glog.Infof(s.switchName + ": forwarding switch/config_msg message to sender\n")
-	toSender <- cm
-	cm = channelMessage{"switch/add_mapping", s.getAddMappingMessageVRF()}
-	glog.Infof(s.switchName + ": forwarding switch/add_mapping message to sender\n")
-	toSender <- cm
-	cm = channelMessage{"switch/add_mapping", s.getAddMappingMessagePort()}
-	glog.Infof(s.switchName + ": forwarding switch/add_mapping message to sender\n")
-	toSender <- cm
-	cm = channelMessage{"switch/add_mapping", s.getAddMappingMessagePortToVRF()}
-	glog.Infof(s.switchName + ": forwarding switch/add_mapping message to sender\n")
-	toSender <- cm
-	/*checkInMessage := s.getCheckInMessage()
-	cmd := "switch/check_in"
-	jsonCheckInMessage, flag := s.marshalMessage(cmd, checkInMessage)
-	if !flag {
-		glog.Infof(s.switchName + ": closing websocket\n")
-		defer conn.Close()
-		allToMainLoop <- s.switchName
-		return false
+	if *recordDir != "" {
+		options = append(options, switchsim.WithRecording(*recordDir))
 	}
-	message := channelMessage{cmd, jsonCheckInMessage}
-	glog.Infof(s.switchName + ": forwarding " + cmd + " message to sender\n")
-	toSender <- message
-
-	configMessage := s.getConfigMessage()
-	cmd = "switch/config_msg"
-	jsonConfigMessage, flag := s.marshalMessage(cmd, configMessage)
-	if !flag {
-		glog.Infof(s.switchName + ": closing websocket\n")
-		defer conn.Close()
-		allToMainLoop <- s.switchName
-		return false
+	var ledger *switchsim.Ledger
+	if *ledgerFile != "" {
+		if ledger, err = switchsim.NewLedger(*ledgerFile); err != nil {
+			glog.Fatalf("Can't create ledger %s: %v\n", *ledgerFile, err)
+		}
 	}
-	message = channelMessage{cmd, jsonConfigMessage}
-	glog.Infof(s.switchName + ": forwarding " + cmd + " message to sender\n")
-	toSender <- message*/
-
-	return true
-}
-
-func (s *switchWebHandler) httpsRequest() bool { //return false if registration fails
-	switchRegistration := SwitchRegistration{Serial: s.switchName, Crt: ""} //Solenoid replaces its cert with switch cert
-	jsonSwitchRegistration, err := json.Marshal(switchRegistration)
-	if err != nil {
-		glog.Errorf(s.switchName+": Can't marshal https registration request: %v\n", err)
-		return false
+	if err := shape.Validate(); err != nil {
+		glog.Fatalf("Can't shape the export: %v\n", err)
 	}
-	_, err = s.httpClient.Post(s.gatewayRegisterURL.String(), "application/json", bytes.NewReader(jsonSwitchRegistration))
-	if err != nil {
-		glog.Errorf(s.switchName+": Error getting https reponse: %v\n", err)
-		return false
+	if *exportRate > 0 {
+		options = append(options, switchsim.WithExport(*exportRate, ledger), switchsim.WithExportShape(&shape))
 	}
-	return true
-}
-
-func main() {
-	flag.Parse()
-	flag.Lookup("logtostderr").Value.Set("true")
-	gateway := gateWay{"172.21.92.97"}
-	numberOfSwitches := 1
-	switchTitle := "harojianSwitchSimulator"
-	s := make([]*switchWebHandler, numberOfSwitches)
-	c := make(chan string, numberOfSwitches)
-	glog.Infof("Start switch registration for %d switches\n", numberOfSwitches)
+	if faults != nil {
+		options = append(options, switchsim.WithFaults(faults))
+	}
+	f := switchsim.NewFleet(ctx, identities, options...)
+	glog.Infof("Start switch registration for %d switches\n", len(placements))
 
-	for i := 0; i < numberOfSwitches; i++ {
-		s[i] = NewSwitchWebHandler(&gateway, switchTitle+string(i))
-		glog.Infof(s[i].switchName + ": Sending https request\n")
-		if !s[i].httpsRequest() {
-			glog.Infof(s[i].switchName + ": https request failed\n")
-		} else {
-			glog.Infof(s[i].switchName + ": https request succeeded\n")
-			glog.Infof(s[i].switchName + ": Sending websocket request\n")
-			if !s[i].WebSocketRequest(c) {
-				glog.Infof(s[i].switchName + ": Websocket request failed\n")
-			}
+	for _, placement := range placements {
+		s, err := f.Add(placement)
+		if err != nil {
+			glog.Fatalf("Can't create switch: %v\n", err)
 		}
+		f.Start(s)
 	}
 	glog.Infof("Registration procedure all done\n")
-	for n := numberOfSwitches; n > 0; {
-		switchName := <-c
-		n--
-		glog.Infof(switchName + ": websocket closed\n")
+	if plan.AgentVersion != "" || plan.ImageName != "" {
+		go f.RollingUpgrade(plan)
+	}
+	if *adminAddr != "" {
+		go func() {
+			glog.Infof("Admin API listening on %s\n", *adminAddr)
+			glog.Fatal(http.ListenAndServe(*adminAddr, &adminServer{fleet: f}))
+		}()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	var consoleDone chan struct{}
+	if *interactive {
+		consoleDone = make(chan struct{})
+		go func() {
+			(&console{fleet: f, in: os.Stdin, out: os.Stdout}).run()
+			close(consoleDone)
+		}()
+	}
+mainLoop:
+	for {
+		select {
+		case switchName := <-f.Closed():
+			glog.Infof(switchName + ": websocket closed\n")
+			if !*interactive && *adminAddr == "" && f.AllDown() {
+				glog.Infof("All websockets closed, quit main loop\n")
+				break mainLoop
+			}
+		case sig := <-signals:
+			glog.Infof("Received %v, shutting down\n", sig)
+			break mainLoop
+		case <-consoleDone:
+			glog.Infof("Console closed, quit\n")
+			break mainLoop
+		}
+	}
+	signal.Stop(signals)
+
+	f.Shutdown(*shutdownTimeout)
+	cancel()
+	if ledger != nil {
+		if err := ledger.Close(); err != nil {
+			glog.Errorf("Can't write ledger %s: %v\n", *ledgerFile, err)
+		}
+	}
+	if *reportFile != "" {
+		if err := writeReport(*reportFile, start, f); err != nil {
+			glog.Errorf("Can't write report %s: %v\n", *reportFile, err)
+		}
 	}
-	glog.Infof("All websockets closed, quit main loop\n")
+	glog.Flush()
 }
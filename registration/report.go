@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+)
+
+type switchReport struct {
+	switchsim.Status
+	Stats switchsim.Stats `json:"stats"`
+}
+
+// runReport is written with -report when the simulator exits. Failures lists
+// the broken collector configurations and schema violations of all switches.
+type runReport struct {
+	Start       time.Time                  `json:"start"`
+	End         time.Time                  `json:"end"`
+	Failures    []string                   `json:"failures"`
+	Assignments switchsim.AssignmentReport `json:"assignments"`
+	Switches    []switchReport             `json:"switches"`
+}
+
+func writeReport(fileName string, start time.Time, f *switchsim.Fleet) error {
+	switches := f.List()
+	report := runReport{Start: start, End: time.Now(), Failures: []string{}, Assignments: f.Assignments(), Switches: make([]switchReport, len(switches))}
+	for i, s := range switches {
+		report.Switches[i] = switchReport{s.Status(), s.Stats()}
+		stats := report.Switches[i].Stats
+		for _, f := range stats.ConfigFailures {
+			report.Failures = append(report.Failures, s.Serial()+": config_msg: "+f)
+		}
+		for _, v := range stats.Violations {
+			report.Failures = append(report.Failures, s.Serial()+": schema: "+v)
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(data, '\n'), 0644)
+}
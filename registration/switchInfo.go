@@ -1,32 +0,0 @@
-package main
-
-import "strings"
-
-var switchcheckinmessage = string("{\"cmd\":\"switch/check_in\",\"switchId\":\"FDO21422KGM\",\"data\":{\"switch_name\":\"P3-STDALONE-LEAF1\",\"systemUpTime\":\"29:21:20:22.000\",\"imageName\":\"bootflash:/nxos.9.2.1.bin\",\"agentVersion\":\"3.1.1.2.nitro.devel\",\"state\":\"\",\"status\":\"\",\"modTs\":\"\",\"capability\":\"standalone\"}}")
-var switchconfigmessage = string("{\"cmd\":\"switch/config_msg\",\"switchId\":\"FDO21422KGM\",\"data\":{\"hwSensorNames\":[\"fwdinst-slot-1-asic-1-slice-1\"],\"slotCount\":1}}")
-var switchaddmappingvrf = string("{\"cmd\":\"switch/add_mapping\",\"switchId\":\"FDO21422KGM\",\"data\":{\"component\":\"VRF\",\"mappings\":[{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_5-0\",\"name\":\"test_ixia_vrf_5-0\",\"id\":\"33\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_6-0\",\"name\":\"test_ixia_vrf_6-0\",\"id\":\"34\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_7-0\",\"name\":\"test_ixia_vrf_7-0\",\"id\":\"35\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_8-0\",\"name\":\"test_ixia_vrf_8-0\",\"id\":\"36\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_9-0\",\"name\":\"test_ixia_vrf_9-0\",\"id\":\"37\"},{\"oper\":\"add\",\"dn\":\"sys/inst-default\",\"name\":\"default\",\"id\":\"1\"},{\"oper\":\"add\",\"dn\":\"sys/inst-management\",\"name\":\"management\",\"id\":\"2\"},{\"oper\":\"add\",\"dn\":\"sys/inst-e2e_sb_vrf\",\"name\":\"e2e_sb_vrf\",\"id\":\"3\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_1-0\",\"name\":\"test_ixia_vrf_1-0\",\"id\":\"4\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_10-0\",\"name\":\"test_ixia_vrf_10-0\",\"id\":\"5\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_11-0\",\"name\":\"test_ixia_vrf_11-0\",\"id\":\"6\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_12-0\",\"name\":\"test_ixia_vrf_12-0\",\"id\":\"7\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_13-0\",\"name\":\"test_ixia_vrf_13-0\",\"id\":\"8\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_14-0\",\"name\":\"test_ixia_vrf_14-0\",\"id\":\"9\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_15-0\",\"name\":\"test_ixia_vrf_15-0\",\"id\":\"10\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_16-0\",\"name\":\"test_ixia_vrf_16-0\",\"id\":\"11\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_17-0\",\"name\":\"test_ixia_vrf_17-0\",\"id\":\"12\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_18-0\",\"name\":\"test_ixia_vrf_18-0\",\"id\":\"13\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_19-0\",\"name\":\"test_ixia_vrf_19-0\",\"id\":\"14\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_2-0\",\"name\":\"test_ixia_vrf_2-0\",\"id\":\"15\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_20-0\",\"name\":\"test_ixia_vrf_20-0\",\"id\":\"16\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_21-0\",\"name\":\"test_ixia_vrf_21-0\",\"id\":\"17\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_22-0\",\"name\":\"test_ixia_vrf_22-0\",\"id\":\"18\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_23-0\",\"name\":\"test_ixia_vrf_23-0\",\"id\":\"19\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_24-0\",\"name\":\"test_ixia_vrf_24-0\",\"id\":\"20\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_25-0\",\"name\":\"test_ixia_vrf_25-0\",\"id\":\"21\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_26-0\",\"name\":\"test_ixia_vrf_26-0\",\"id\":\"22\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_27-0\",\"name\":\"test_ixia_vrf_27-0\",\"id\":\"23\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_28-0\",\"name\":\"test_ixia_vrf_28-0\",\"id\":\"24\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_29-0\",\"name\":\"test_ixia_vrf_29-0\",\"id\":\"25\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_3-0\",\"name\":\"test_ixia_vrf_3-0\",\"id\":\"26\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_30-0\",\"name\":\"test_ixia_vrf_30-0\",\"id\":\"27\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_31-0\",\"name\":\"test_ixia_vrf_31-0\",\"id\":\"28\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_32-0\",\"name\":\"test_ixia_vrf_32-0\",\"id\":\"29\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_33-0\",\"name\":\"test_ixia_vrf_33-0\",\"id\":\"30\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_34-0\",\"name\":\"test_ixia_vrf_34-0\",\"id\":\"31\"},{\"oper\":\"add\",\"dn\":\"sys/inst-test_ixia_vrf_4-0\",\"name\":\"test_ixia_vrf_4-0\",\"id\":\"32\"}]}}")
-var switchaddmappingport = string("{\"cmd\":\"switch/add_mapping\",\"switchId\":\"FDO21422KGM\",\"data\":{\"component\":\"PORT\",\"mappings\":[{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/33]/phys\",\"name\":\"eth1/33\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/34]/phys\",\"name\":\"eth1/34\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/35]/phys\",\"name\":\"eth1/35\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/36]/phys\",\"name\":\"eth1/36\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/37]/phys\",\"name\":\"eth1/37\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/38]/phys\",\"name\":\"eth1/38\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/39]/phys\",\"name\":\"eth1/39\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/40]/phys\",\"name\":\"eth1/40\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/41]/phys\",\"name\":\"eth1/41\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/42]/phys\",\"name\":\"eth1/42\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/43]/phys\",\"name\":\"eth1/43\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/44]/phys\",\"name\":\"eth1/44\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/45]/phys\",\"name\":\"eth1/45\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/46]/phys\",\"name\":\"eth1/46\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/47]/phys\",\"name\":\"eth1/47\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/48]/phys\",\"name\":\"eth1/48\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/49]/phys\",\"name\":\"eth1/49\",\"operSt\":\"up\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/50]/phys\",\"name\":\"eth1/50\",\"operSt\":\"up\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/51]/phys\",\"name\":\"eth1/51\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/52]/phys\",\"name\":\"eth1/52\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/53]/phys\",\"name\":\"eth1/53\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/54]/phys\",\"name\":\"eth1/54\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/1]/phys\",\"name\":\"eth1/1\",\"operSt\":\"up\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/2]/phys\",\"name\":\"eth1/2\",\"operSt\":\"up\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/3]/phys\",\"name\":\"eth1/3\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/4]/phys\",\"name\":\"eth1/4\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/5]/phys\",\"name\":\"eth1/5\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/6]/phys\",\"name\":\"eth1/6\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/7]/phys\",\"name\":\"eth1/7\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/8]/phys\",\"name\":\"eth1/8\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/9]/phys\",\"name\":\"eth1/9\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/10]/phys\",\"name\":\"eth1/10\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/11]/phys\",\"name\":\"eth1/11\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/12]/phys\",\"name\":\"eth1/12\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/13]/phys\",\"name\":\"eth1/13\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/14]/phys\",\"name\":\"eth1/14\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/15]/phys\",\"name\":\"eth1/15\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/16]/phys\",\"name\":\"eth1/16\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/17]/phys\",\"name\":\"eth1/17\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/18]/phys\",\"name\":\"eth1/18\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/19]/phys\",\"name\":\"eth1/19\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/20]/phys\",\"name\":\"eth1/20\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/21]/phys\",\"name\":\"eth1/21\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/22]/phys\",\"name\":\"eth1/22\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/23]/phys\",\"name\":\"eth1/23\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/24]/phys\",\"name\":\"eth1/24\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/25]/phys\",\"name\":\"eth1/25\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/26]/phys\",\"name\":\"eth1/26\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/27]/phys\",\"name\":\"eth1/27\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/28]/phys\",\"name\":\"eth1/28\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/29]/phys\",\"name\":\"eth1/29\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/30]/phys\",\"name\":\"eth1/30\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/31]/phys\",\"name\":\"eth1/31\",\"operSt\":\"down\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/32]/phys\",\"name\":\"eth1/32\",\"operSt\":\"down\"}]}}")
-var switchaddmappingporttovrf = string("{\"cmd\":\"switch/add_mapping\",\"switchId\":\"FDO21422KGM\",\"data\":{\"component\":\"PORT2VRF\",\"mappings\":[{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2006]/rtvrfMbr\",\"portName\":\"vlan2006\",\"vrfName\":\"test_ixia_vrf_7-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2007]/rtvrfMbr\",\"portName\":\"vlan2007\",\"vrfName\":\"test_ixia_vrf_8-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2008]/rtvrfMbr\",\"portName\":\"vlan2008\",\"vrfName\":\"test_ixia_vrf_9-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2009]/rtvrfMbr\",\"portName\":\"vlan2009\",\"vrfName\":\"test_ixia_vrf_10-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2010]/rtvrfMbr\",\"portName\":\"vlan2010\",\"vrfName\":\"test_ixia_vrf_11-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2011]/rtvrfMbr\",\"portName\":\"vlan2011\",\"vrfName\":\"test_ixia_vrf_12-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2012]/rtvrfMbr\",\"portName\":\"vlan2012\",\"vrfName\":\"test_ixia_vrf_34-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2013]/rtvrfMbr\",\"portName\":\"vlan2013\",\"vrfName\":\"test_ixia_vrf_33-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2014]/rtvrfMbr\",\"portName\":\"vlan2014\",\"vrfName\":\"test_ixia_vrf_32-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2015]/rtvrfMbr\",\"portName\":\"vlan2015\",\"vrfName\":\"test_ixia_vrf_31-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2016]/rtvrfMbr\",\"portName\":\"vlan2016\",\"vrfName\":\"test_ixia_vrf_30-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2017]/rtvrfMbr\",\"portName\":\"vlan2017\",\"vrfName\":\"test_ixia_vrf_29-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2018]/rtvrfMbr\",\"portName\":\"vlan2018\",\"vrfName\":\"test_ixia_vrf_28-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2019]/rtvrfMbr\",\"portName\":\"vlan2019\",\"vrfName\":\"test_ixia_vrf_27-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2020]/rtvrfMbr\",\"portName\":\"vlan2020\",\"vrfName\":\"test_ixia_vrf_26-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2021]/rtvrfMbr\",\"portName\":\"vlan2021\",\"vrfName\":\"test_ixia_vrf_25-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2022]/rtvrfMbr\",\"portName\":\"vlan2022\",\"vrfName\":\"test_ixia_vrf_24-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2023]/rtvrfMbr\",\"portName\":\"vlan2023\",\"vrfName\":\"test_ixia_vrf_23-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2024]/rtvrfMbr\",\"portName\":\"vlan2024\",\"vrfName\":\"test_ixia_vrf_22-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2025]/rtvrfMbr\",\"portName\":\"vlan2025\",\"vrfName\":\"test_ixia_vrf_21-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2026]/rtvrfMbr\",\"portName\":\"vlan2026\",\"vrfName\":\"test_ixia_vrf_20-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2027]/rtvrfMbr\",\"portName\":\"vlan2027\",\"vrfName\":\"test_ixia_vrf_19-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2028]/rtvrfMbr\",\"portName\":\"vlan2028\",\"vrfName\":\"test_ixia_vrf_18-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2029]/rtvrfMbr\",\"portName\":\"vlan2029\",\"vrfName\":\"test_ixia_vrf_17-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2030]/rtvrfMbr\",\"portName\":\"vlan2030\",\"vrfName\":\"test_ixia_vrf_16-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2031]/rtvrfMbr\",\"portName\":\"vlan2031\",\"vrfName\":\"test_ixia_vrf_15-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2032]/rtvrfMbr\",\"portName\":\"vlan2032\",\"vrfName\":\"test_ixia_vrf_14-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2033]/rtvrfMbr\",\"portName\":\"vlan2033\",\"vrfName\":\"test_ixia_vrf_13-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/lb-[lo0]/rtvrfMbr\",\"portName\":\"lo0\",\"vrfName\":\"default\"},{\"oper\":\"add\",\"dn\":\"sys/intf/lb-[lo1]/rtvrfMbr\",\"portName\":\"lo1\",\"vrfName\":\"default\"},{\"oper\":\"add\",\"dn\":\"sys/mgmt-[mgmt0]/rtvrfMbr\",\"portName\":\"mgmt0\",\"vrfName\":\"management\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/2]/rtvrfMbr\",\"portName\":\"eth1/2\",\"vrfName\":\"e2e_sb_vrf\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/49]/rtvrfMbr\",\"portName\":\"eth1/49\",\"vrfName\":\"default\"},{\"oper\":\"add\",\"dn\":\"sys/intf/phys-[eth1/50]/rtvrfMbr\",\"portName\":\"eth1/50\",\"vrfName\":\"default\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan1]/rtvrfMbr\",\"portName\":\"vlan1\",\"vrfName\":\"default\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan700]/rtvrfMbr\",\"portName\":\"vlan700\",\"vrfName\":\"test_ixia_vrf_1-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan701]/rtvrfMbr\",\"portName\":\"vlan701\",\"vrfName\":\"test_ixia_vrf_2-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan702]/rtvrfMbr\",\"portName\":\"vlan702\",\"vrfName\":\"test_ixia_vrf_3-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan703]/rtvrfMbr\",\"portName\":\"vlan703\",\"vrfName\":\"test_ixia_vrf_4-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan704]/rtvrfMbr\",\"portName\":\"vlan704\",\"vrfName\":\"test_ixia_vrf_5-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan705]/rtvrfMbr\",\"portName\":\"vlan705\",\"vrfName\":\"test_ixia_vrf_6-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan706]/rtvrfMbr\",\"portName\":\"vlan706\",\"vrfName\":\"test_ixia_vrf_7-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan707]/rtvrfMbr\",\"portName\":\"vlan707\",\"vrfName\":\"test_ixia_vrf_8-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan708]/rtvrfMbr\",\"portName\":\"vlan708\",\"vrfName\":\"test_ixia_vrf_9-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan709]/rtvrfMbr\",\"portName\":\"vlan709\",\"vrfName\":\"test_ixia_vrf_10-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan710]/rtvrfMbr\",\"portName\":\"vlan710\",\"vrfName\":\"test_ixia_vrf_11-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan711]/rtvrfMbr\",\"portName\":\"vlan711\",\"vrfName\":\"test_ixia_vrf_12-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan712]/rtvrfMbr\",\"portName\":\"vlan712\",\"vrfName\":\"test_ixia_vrf_13-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan713]/rtvrfMbr\",\"portName\":\"vlan713\",\"vrfName\":\"test_ixia_vrf_14-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan714]/rtvrfMbr\",\"portName\":\"vlan714\",\"vrfName\":\"test_ixia_vrf_15-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan715]/rtvrfMbr\",\"portName\":\"vlan715\",\"vrfName\":\"test_ixia_vrf_16-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan716]/rtvrfMbr\",\"portName\":\"vlan716\",\"vrfName\":\"test_ixia_vrf_17-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan717]/rtvrfMbr\",\"portName\":\"vlan717\",\"vrfName\":\"test_ixia_vrf_18-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan718]/rtvrfMbr\",\"portName\":\"vlan718\",\"vrfName\":\"test_ixia_vrf_19-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan719]/rtvrfMbr\",\"portName\":\"vlan719\",\"vrfName\":\"test_ixia_vrf_20-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan720]/rtvrfMbr\",\"portName\":\"vlan720\",\"vrfName\":\"test_ixia_vrf_21-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan721]/rtvrfMbr\",\"portName\":\"vlan721\",\"vrfName\":\"test_ixia_vrf_22-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan722]/rtvrfMbr\",\"portName\":\"vlan722\",\"vrfName\":\"test_ixia_vrf_23-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan723]/rtvrfMbr\",\"portName\":\"vlan723\",\"vrfName\":\"test_ixia_vrf_24-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan724]/rtvrfMbr\",\"portName\":\"vlan724\",\"vrfName\":\"test_ixia_vrf_25-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan725]/rtvrfMbr\",\"portName\":\"vlan725\",\"vrfName\":\"test_ixia_vrf_26-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan726]/rtvrfMbr\",\"portName\":\"vlan726\",\"vrfName\":\"test_ixia_vrf_27-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan727]/rtvrfMbr\",\"portName\":\"vlan727\",\"vrfName\":\"test_ixia_vrf_28-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan728]/rtvrfMbr\",\"portName\":\"vlan728\",\"vrfName\":\"test_ixia_vrf_29-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan729]/rtvrfMbr\",\"portName\":\"vlan729\",\"vrfName\":\"test_ixia_vrf_30-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan730]/rtvrfMbr\",\"portName\":\"vlan730\",\"vrfName\":\"test_ixia_vrf_31-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan731]/rtvrfMbr\",\"portName\":\"vlan731\",\"vrfName\":\"test_ixia_vrf_32-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan732]/rtvrfMbr\",\"portName\":\"vlan732\",\"vrfName\":\"test_ixia_vrf_33-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan733]/rtvrfMbr\",\"portName\":\"vlan733\",\"vrfName\":\"test_ixia_vrf_34-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2000]/rtvrfMbr\",\"portName\":\"vlan2000\",\"vrfName\":\"test_ixia_vrf_1-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2001]/rtvrfMbr\",\"portName\":\"vlan2001\",\"vrfName\":\"test_ixia_vrf_2-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2002]/rtvrfMbr\",\"portName\":\"vlan2002\",\"vrfName\":\"test_ixia_vrf_3-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2003]/rtvrfMbr\",\"portName\":\"vlan2003\",\"vrfName\":\"test_ixia_vrf_4-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2004]/rtvrfMbr\",\"portName\":\"vlan2004\",\"vrfName\":\"test_ixia_vrf_5-0\"},{\"oper\":\"add\",\"dn\":\"sys/intf/svi-[vlan2005]/rtvrfMbr\",\"portName\":\"vlan2005\",\"vrfName\":\"test_ixia_vrf_6-0\"}]}}")
-
-func (s *switchWebHandler) getCheckInMessage() []byte {
-	message := strings.Replace(switchcheckinmessage, "FDO21422KGM", s.switchName, -1)
-	return []byte(message)
-}
-
-func (s *switchWebHandler) getConfigMessage() []byte {
-	message := strings.Replace(switchconfigmessage, "FDO21422KGM", s.switchName, -1)
-	return []byte(message)
-}
-
-func (s *switchWebHandler) getAddMappingMessageVRF() []byte {
-	message := strings.Replace(switchaddmappingvrf, "FDO21422KGM", s.switchName, -1)
-	return []byte(message)
-}
-func (s *switchWebHandler) getAddMappingMessagePort() []byte {
-	message := strings.Replace(switchaddmappingport, "FDO21422KGM", s.switchName, -1)
-	return []byte(message)
-}
-func (s *switchWebHandler) getAddMappingMessagePortToVRF() []byte {
-	message := strings.Replace(switchaddmappingporttovrf, "FDO21422KGM", s.switchName, -1)
-	return []byte(message)
-}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/HJ4Tetration/switchSimulator/switchsim"
+	"github.com/golang/glog"
+)
+
+// readConfig reads a switch/config_msg as the gateway sends it, plain or as
+// the escaped string a switch agent logs.
+func readConfig(fileName string) (*switchsim.ServerConfigMessage, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	body := strings.TrimSpace(string(raw))
+	if !json.Valid([]byte(body)) {
+		if err = json.Unmarshal([]byte("\""+body+"\""), &body); err != nil {
+			return nil, err
+		}
+	}
+	var config switchsim.ServerConfigMessage
+	if err = json.Unmarshal([]byte(body), &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// collectorServer is the HTTP API tests read the tallies from:
+//
+//	GET    /collectors          tallies of all collectors
+//	GET    /collectors/<name>   tally of one collector
+//	POST   /reset               forget everything received so far
+type collectorServer struct {
+	collectors []*switchsim.StubCollector
+}
+
+func (c *collectorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "reset" && r.Method == http.MethodPost:
+		for _, collector := range c.collectors {
+			collector.Reset()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "collectors" && r.Method == http.MethodGet && len(parts) <= 2:
+		var tallies []switchsim.CollectorTally
+		for _, collector := range c.collectors {
+			if len(parts) == 1 || parts[1] == collector.Name() {
+				tallies = append(tallies, collector.Tally())
+			}
+		}
+		if len(parts) == 1 {
+			writeJSON(w, tallies)
+		} else if len(tallies) == 1 {
+			writeJSON(w, tallies[0])
+		} else {
+			http.Error(w, "no collector "+parts[1], http.StatusNotFound)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func main() {
+	configFile := flag.String("config", "../logParser/configMessageFromGateway", "switch/config_msg whose active collectors to run")
+	bindIP := flag.String("bind", "", "IP to listen on instead of each collector's ip, e.g. 0.0.0.0")
+	httpAddr := flag.String("http", ":8090", "address of the HTTP API serving the tallies")
+	receivedFile := flag.String("received", "", "write every received flow to this file for ledgerVerify")
+	flag.Parse()
+	flag.Lookup("logtostderr").Value.Set("true")
+
+	config, err := readConfig(*configFile)
+	if err != nil {
+		glog.Fatalf("Can't read config_msg %s: %v\n", *configFile, err)
+	}
+	var received *switchsim.Ledger
+	if *receivedFile != "" {
+		if received, err = switchsim.NewLedger(*receivedFile); err != nil {
+			glog.Fatalf("Can't create %s: %v\n", *receivedFile, err)
+		}
+	}
+	server := &collectorServer{}
+	for _, c := range config.Data.Active {
+		ip := c.IP
+		if *bindIP != "" {
+			ip = *bindIP
+		}
+		var addrs []string
+		for _, port := range []int{c.UDPPort, c.SpineUDPPort} {
+			if port != 0 {
+				addrs = append(addrs, net.JoinHostPort(ip, strconv.Itoa(port)))
+			}
+		}
+		collector, err := switchsim.NewStubCollector(c.Name, addrs, received)
+		if err != nil {
+			glog.Fatalf("Can't start collector %s: %v\n", c.Name, err)
+		}
+		glog.Infof("Collector %s listening on %s\n", c.Name, strings.Join(addrs, ", "))
+		server.collectors = append(server.collectors, collector)
+	}
+	if len(server.collectors) == 0 {
+		glog.Fatalf("No active collector in %s\n", *configFile)
+	}
+	go func() {
+		glog.Infof("Tallies served on %s\n", *httpAddr)
+		glog.Fatal(http.ListenAndServe(*httpAddr, server))
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	glog.Infof("Received %v, shutting down\n", sig)
+	for _, collector := range server.collectors {
+		collector.Close()
+	}
+	if received != nil {
+		if err := received.Close(); err != nil {
+			glog.Errorf("Can't write %s: %v\n", *receivedFile, err)
+		}
+	}
+	glog.Flush()
+}
@@ -0,0 +1,214 @@
+package switchsim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAssignmentChanges is how many changes an assignment analyzer keeps.
+const maxAssignmentChanges = 1000
+
+// CollectorLoad is what one collector is assigned across the fleet. Flow
+// shares assume flows hash evenly, so a bucket gets its width's share of a
+// switch's flows.
+type CollectorLoad struct {
+	Name           string  `json:"name"`
+	Healthy        bool    `json:"healthy"`        // healthy and active for every switch that knows it
+	Switches       int     `json:"switches"`       // switches exporting some flows to it
+	FlowShare      float64 `json:"flowShare"`      // share of all switches' flows it is primary for
+	SecondaryShare float64 `json:"secondaryShare"` // share of all switches' flows it is secondary for
+}
+
+// BucketMapGroup is a set of switches that got the same bucket map.
+type BucketMapGroup struct {
+	Switches []string          `json:"switches"`
+	Buckets  []CollectorBucket `json:"buckets"`
+}
+
+// AssignmentChange is how a config_msg changed a switch's collectors.
+type AssignmentChange struct {
+	Time           time.Time `json:"time"`
+	Serial         string    `json:"serial"`
+	Added          []string  `json:"added,omitempty"`          // collectors that became active
+	Removed        []string  `json:"removed,omitempty"`        // collectors that are no longer active
+	Decommissioned []string  `json:"decommissioned,omitempty"` // collectors now marked decommissioned
+	Reassigned     int       `json:"reassigned"`               // hashes that got another primary
+}
+
+// AssignmentReport compares the collector assignments of all switches.
+type AssignmentReport struct {
+	Switches   int                `json:"switches"` // switches that got a config_msg
+	Collectors []CollectorLoad    `json:"collectors"`
+	Agree      bool               `json:"agree"` // all switches got the same bucket map
+	BucketMaps []BucketMapGroup   `json:"bucketMaps"`
+	Skew       float64            `json:"skew"` // flow share of the busiest healthy collector over the mean
+	Changes    []AssignmentChange `json:"changes"`
+}
+
+// AssignmentAnalyzer collects the config_msg of every switch of a fleet.
+type AssignmentAnalyzer struct {
+	mu      sync.Mutex
+	configs map[string]*ServerConfigMessage // by serial
+	changes []AssignmentChange
+}
+
+func NewAssignmentAnalyzer() *AssignmentAnalyzer {
+	return &AssignmentAnalyzer{configs: make(map[string]*ServerConfigMessage)}
+}
+
+// Observe records the config_msg a switch got.
+func (a *AssignmentAnalyzer) Observe(serial string, config *ServerConfigMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if previous, ok := a.configs[serial]; ok {
+		change := compareAssignments(previous, config)
+		if len(change.Added)+len(change.Removed)+len(change.Decommissioned)+change.Reassigned > 0 && len(a.changes) < maxAssignmentChanges {
+			change.Time = time.Now()
+			change.Serial = serial
+			a.changes = append(a.changes, change)
+		}
+	}
+	a.configs[serial] = config
+}
+
+// Forget drops a switch that left the fleet.
+func (a *AssignmentAnalyzer) Forget(serial string) {
+	a.mu.Lock()
+	delete(a.configs, serial)
+	a.mu.Unlock()
+}
+
+// reassignedHashes counts the hashes whose primary collector differs between
+// two bucket maps, going by bucket edges rather than hash by hash.
+func reassignedHashes(previous []CollectorBucket, buckets []CollectorBucket) int {
+	edges := bucketEdges(previous, buckets)
+	reassigned := 0
+	for i := 1; i < len(edges); i++ {
+		if primaryOf(previous, edges[i-1]) != primaryOf(buckets, edges[i-1]) {
+			reassigned += edges[i] - edges[i-1]
+		}
+	}
+	return reassigned
+}
+
+// primaryOf returns the primary collector of a hash.
+func primaryOf(buckets []CollectorBucket, hash int) string {
+	b, _ := bucketOf(buckets, hash)
+	return b.Primary
+}
+
+func compareAssignments(previous *ServerConfigMessage, config *ServerConfigMessage) AssignmentChange {
+	var change AssignmentChange
+	before := make(map[string]CollectorMessage)
+	for _, c := range previous.Data.Active {
+		before[c.Name] = c
+	}
+	after := make(map[string]bool)
+	for _, c := range config.Data.Active {
+		after[c.Name] = true
+		b, ok := before[c.Name]
+		if !ok {
+			change.Added = append(change.Added, c.Name)
+		}
+		if c.Decommissioned && (!ok || !b.Decommissioned) {
+			change.Decommissioned = append(change.Decommissioned, c.Name)
+		}
+	}
+	for name := range before {
+		if !after[name] {
+			change.Removed = append(change.Removed, name)
+		}
+	}
+	sort.Strings(change.Removed)
+	change.Reassigned = reassignedHashes(previous.Data.Buckets, config.Data.Buckets)
+	return change
+}
+
+// bucketMapKey identifies a bucket map independently of the bucket order.
+func bucketMapKey(buckets []CollectorBucket) string {
+	keys := make([]string, len(buckets))
+	for i, b := range buckets {
+		keys[i] = fmt.Sprintf("%d-%d:%s/%s", b.Lo, b.Hi, b.Primary, b.Secondary)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Report analyzes the assignments of the switches' latest config_msg.
+func (a *AssignmentAnalyzer) Report() AssignmentReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	report := AssignmentReport{Switches: len(a.configs), Changes: append([]AssignmentChange{}, a.changes...)}
+	loads := make(map[string]*CollectorLoad)
+	load := func(name string) *CollectorLoad {
+		if loads[name] == nil {
+			loads[name] = &CollectorLoad{Name: name, Healthy: true}
+		}
+		return loads[name]
+	}
+	groups := make(map[string]*BucketMapGroup)
+	serials := make([]string, 0, len(a.configs))
+	for serial := range a.configs {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	for _, serial := range serials {
+		config := a.configs[serial]
+		for _, c := range config.Data.Active {
+			l := load(c.Name)
+			l.Healthy = l.Healthy && c.Healthy && !c.Decommissioned
+		}
+		exports := make(map[string]bool)
+		edges := bucketEdges(config.Data.Buckets)
+		for i := 1; i < len(edges); i++ {
+			b, ok := bucketOf(config.Data.Buckets, edges[i-1])
+			if !ok {
+				continue
+			}
+			share := float64(edges[i]-edges[i-1]) / float64(bucketHashMax+1) / float64(len(a.configs))
+			load(b.Primary).FlowShare += share
+			load(b.Secondary).SecondaryShare += share
+			exports[b.Primary] = true
+		}
+		for name := range exports {
+			load(name).Switches++
+		}
+		key := bucketMapKey(config.Data.Buckets)
+		if groups[key] == nil {
+			groups[key] = &BucketMapGroup{Buckets: config.Data.Buckets}
+		}
+		groups[key].Switches = append(groups[key].Switches, serial)
+	}
+
+	var healthy []float64
+	for _, l := range loads {
+		report.Collectors = append(report.Collectors, *l)
+		if l.Healthy {
+			healthy = append(healthy, l.FlowShare)
+		}
+	}
+	sort.Slice(report.Collectors, func(i, j int) bool { return report.Collectors[i].Name < report.Collectors[j].Name })
+	if len(healthy) > 0 {
+		busiest, total := 0.0, 0.0
+		for _, share := range healthy {
+			total += share
+			if share > busiest {
+				busiest = share
+			}
+		}
+		if total > 0 {
+			report.Skew = busiest / (total / float64(len(healthy)))
+		}
+	}
+	for _, g := range groups {
+		report.BucketMaps = append(report.BucketMaps, *g)
+	}
+	sort.Slice(report.BucketMaps, func(i, j int) bool {
+		return len(report.BucketMaps[i].Switches) > len(report.BucketMaps[j].Switches)
+	})
+	report.Agree = len(report.BucketMaps) <= 1
+	return report
+}
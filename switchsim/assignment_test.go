@@ -0,0 +1,110 @@
+package switchsim
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReassignedHashes(t *testing.T) {
+	half := []CollectorBucket{{0, 32767, "c1", "c2"}, {32768, 65535, "c2", "c1"}}
+	tests := []struct {
+		name     string
+		previous []CollectorBucket
+		buckets  []CollectorBucket
+		want     int
+	}{
+		{"same", half, half, 0},
+		{"secondaries swapped", half, []CollectorBucket{{0, 32767, "c1", "c1"}, {32768, 65535, "c2", "c2"}}, 0},
+		{"primaries swapped", half, []CollectorBucket{{0, 32767, "c2", "c1"}, {32768, 65535, "c1", "c2"}}, 65536},
+		{"boundary moved", half, []CollectorBucket{{0, 32867, "c1", "c2"}, {32868, 65535, "c2", "c1"}}, 100},
+		{"from nothing", nil, half, 65536},
+		{"to a gap", half, []CollectorBucket{{0, 32767, "c1", "c2"}}, 32768},
+		{"overlap, the first bucket counts", half, []CollectorBucket{{0, 65535, "c1", "c2"}, {32768, 65535, "c2", "c1"}}, 32768},
+		{"outside the hash space", []CollectorBucket{{-10, 70000, "c1", "c2"}}, []CollectorBucket{{-5, 10, "c2", "c1"}, {11, 80000, "c1", "c2"}}, 11},
+		{"lo above hi", half, append([]CollectorBucket{{10, 5, "c3", "c3"}}, half...), 0},
+	}
+	for _, test := range tests {
+		if got := reassignedHashes(test.previous, test.buckets); got != test.want {
+			t.Errorf("%s: %d hashes reassigned, want %d", test.name, got, test.want)
+		}
+		// Hash by hash, as a check of the edges.
+		brute := 0
+		for h := 0; h <= bucketHashMax; h++ {
+			if primaryOf(test.previous, h) != primaryOf(test.buckets, h) {
+				brute++
+			}
+		}
+		if brute != test.want {
+			t.Errorf("%s: %d hashes reassigned hash by hash, want %d", test.name, brute, test.want)
+		}
+	}
+}
+
+// With overlapping buckets the report's flow shares are where the exporter
+// sends the flows.
+func TestAssignmentsMatchExport(t *testing.T) {
+	buckets := []CollectorBucket{{0, 49151, "c1", "c2"}, {16384, 65535, "c2", "c1"}}
+	collectors := make(map[string]net.PacketConn)
+	config := &ServerConfigMessage{}
+	config.Data.Buckets = buckets
+	for _, name := range []string{"c1", "c2"} {
+		collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer collector.Close()
+		collectors[name] = collector
+		config.Data.Active = append(config.Data.Active, CollectorMessage{Name: name, IP: "127.0.0.1", Healthy: true, UDPPort: collector.LocalAddr().(*net.UDPAddr).Port})
+	}
+
+	analyzer := NewAssignmentAnalyzer()
+	analyzer.Observe("FDO1", config)
+	shares := make(map[string]float64)
+	for _, l := range analyzer.Report().Collectors {
+		shares[l.Name] = l.FlowShare
+	}
+	if math.Abs(shares["c1"]-0.75) > 1e-9 || math.Abs(shares["c2"]-0.25) > 1e-9 {
+		t.Errorf("flow shares %v, want c1 0.75 and c2 0.25", shares)
+	}
+
+	s, err := NewSwitch(WithGateway("gw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.collectorConfig = config
+	defer s.closeExport()
+	const flows = 2000
+	if !s.exportFlows(context.Background(), 0, flows) {
+		t.Fatal("exportFlows failed")
+	}
+	received := make(map[string]int)
+	b := make([]byte, 65536)
+	for name, collector := range collectors {
+		for {
+			collector.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, _, err := collector.ReadFrom(b)
+			if err != nil {
+				break
+			}
+			d, err := DecodeExport(b[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range d.Records {
+				if primaryOf(buckets, FlowHash(r.Flow)) != name {
+					t.Errorf("flow with hash %d exported to %s", FlowHash(r.Flow), name)
+				}
+			}
+			received[name] += len(d.Records)
+		}
+	}
+	if received["c1"]+received["c2"] != flows {
+		t.Fatalf("collectors received %v, want %d flows", received, flows)
+	}
+	if share := float64(received["c1"]) / flows; math.Abs(share-shares["c1"]) > 0.05 {
+		t.Errorf("c1 received %.2f of the flows, the report says %.2f", share, shares["c1"])
+	}
+}
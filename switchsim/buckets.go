@@ -0,0 +1,143 @@
+package switchsim
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+)
+
+// Buckets split the flow hash space [0, bucketHashMax] between collectors.
+const bucketHashMax = 65535
+
+// bucketOf returns the bucket a hash is exported to, the first that holds it
+// as the switch looks it up, false if no bucket does.
+func bucketOf(buckets []CollectorBucket, hash int) (CollectorBucket, bool) {
+	for _, b := range buckets {
+		if b.Lo <= hash && hash <= b.Hi {
+			return b, true
+		}
+	}
+	return CollectorBucket{}, false
+}
+
+// bucketEdges returns the hashes from 0 to past the hash space, sorted and
+// without duplicates, between which no bucket of the maps starts or ends.
+func bucketEdges(maps ...[]CollectorBucket) []int {
+	edges := []int{0, bucketHashMax + 1}
+	for _, buckets := range maps {
+		for _, b := range buckets {
+			edges = append(edges, clampHash(b.Lo), clampHash(b.Hi+1))
+		}
+	}
+	sort.Ints(edges)
+	unique := edges[:1]
+	for _, edge := range edges[1:] {
+		if edge > unique[len(unique)-1] {
+			unique = append(unique, edge)
+		}
+	}
+	return unique
+}
+
+// clampHash limits a bucket edge to the hash space and the end past it.
+func clampHash(hash int) int {
+	if hash < 0 {
+		return 0
+	}
+	if hash > bucketHashMax+1 {
+		return bucketHashMax + 1
+	}
+	return hash
+}
+
+// maxConfigFailures is how many failed config checks a switch keeps for the
+// report.
+const maxConfigFailures = 20
+
+// bucketFailures checks the buckets of a config_msg: together they cover the
+// hash space without gaps or overlaps, and each one's primary and secondary
+// are different healthy active collectors.
+func bucketFailures(config *ServerConfigMessage) []string {
+	var failures []string
+	healthy := make(map[string]bool)
+	for _, c := range config.Data.Active {
+		healthy[c.Name] = c.Healthy && !c.Decommissioned
+	}
+	deactivated := make(map[string]bool)
+	for _, c := range config.Data.Deactivated {
+		deactivated[c.Name] = true
+	}
+	collector := func(b CollectorBucket, role string, name string) {
+		h, active := healthy[name]
+		switch {
+		case name == "":
+			failures = append(failures, fmt.Sprintf("bucket %d-%d has no %s", b.Lo, b.Hi, role))
+		case deactivated[name] && !active:
+			failures = append(failures, fmt.Sprintf("bucket %d-%d %s %s is deactivated", b.Lo, b.Hi, role, name))
+		case !active:
+			failures = append(failures, fmt.Sprintf("bucket %d-%d %s %s is not an active collector", b.Lo, b.Hi, role, name))
+		case !h:
+			failures = append(failures, fmt.Sprintf("bucket %d-%d %s %s is not healthy", b.Lo, b.Hi, role, name))
+		}
+	}
+
+	buckets := append([]CollectorBucket(nil), config.Data.Buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Lo < buckets[j].Lo })
+	next := 0 // lowest hash not covered yet
+	for _, b := range buckets {
+		if b.Lo > b.Hi {
+			failures = append(failures, fmt.Sprintf("bucket %d-%d has lo above hi", b.Lo, b.Hi))
+			continue
+		}
+		if b.Lo < 0 || b.Hi > bucketHashMax {
+			failures = append(failures, fmt.Sprintf("bucket %d-%d is outside the hash space 0-%d", b.Lo, b.Hi, bucketHashMax))
+		}
+		switch {
+		case b.Lo > next:
+			failures = append(failures, fmt.Sprintf("hashes %d-%d are in no bucket", next, b.Lo-1))
+		case b.Lo < next:
+			failures = append(failures, fmt.Sprintf("bucket %d-%d overlaps hashes %d-%d", b.Lo, b.Hi, b.Lo, minInt(b.Hi, next-1)))
+		}
+		if b.Hi+1 > next {
+			next = b.Hi + 1
+		}
+		collector(b, "primary", b.Primary)
+		collector(b, "secondary", b.Secondary)
+		if b.Primary != "" && b.Primary == b.Secondary {
+			failures = append(failures, fmt.Sprintf("bucket %d-%d has %s as primary and secondary", b.Lo, b.Hi, b.Primary))
+		}
+	}
+	if next <= bucketHashMax {
+		failures = append(failures, fmt.Sprintf("hashes %d-%d are in no bucket", next, bucketHashMax))
+	}
+	return failures
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// checkConfig records the collector configuration the gateway sent and the
+// bucket invariants it breaks.
+func (s *Switch) checkConfig(config *ServerConfigMessage) {
+	failures := bucketFailures(config)
+	s.mu.Lock()
+	s.collectorConfig = config
+	s.stats.ConfigChecks++
+	s.stats.ConfigFailureCount += len(failures)
+	for _, f := range failures {
+		glog.Errorf(s.switchName + ": config_msg: " + f + "\n")
+		if len(s.stats.ConfigFailures) < maxConfigFailures {
+			s.stats.ConfigFailures = append(s.stats.ConfigFailures, f)
+		}
+	}
+	s.mu.Unlock()
+	s.wakeExporter()
+	for _, fn := range s.onConfig {
+		fn(s, config)
+	}
+}
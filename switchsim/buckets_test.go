@@ -0,0 +1,110 @@
+package switchsim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBucketFailures(t *testing.T) {
+	c1 := CollectorMessage{Name: "c1", Healthy: true}
+	c2 := CollectorMessage{Name: "c2", Healthy: true}
+	sick := CollectorMessage{Name: "sick"}
+	gone := CollectorMessage{Name: "gone", Healthy: true, Decommissioned: true}
+	old := CollectorMessage{Name: "old", Healthy: true}
+	tests := []struct {
+		name     string
+		buckets  []CollectorBucket
+		active   []CollectorMessage
+		failures []string
+	}{
+		{
+			name:    "two buckets cover the hash space",
+			buckets: []CollectorBucket{{32768, 65535, "c2", "c1"}, {0, 32767, "c1", "c2"}},
+			active:  []CollectorMessage{c1, c2},
+		},
+		{
+			name:     "no buckets",
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"hashes 0-65535 are in no bucket"},
+		},
+		{
+			name:     "gap at the start",
+			buckets:  []CollectorBucket{{10, 65535, "c1", "c2"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"hashes 0-9 are in no bucket"},
+		},
+		{
+			name:     "gap in the middle",
+			buckets:  []CollectorBucket{{0, 99, "c1", "c2"}, {200, 65535, "c2", "c1"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"hashes 100-199 are in no bucket"},
+		},
+		{
+			name:     "gap at the end",
+			buckets:  []CollectorBucket{{0, 65000, "c1", "c2"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"hashes 65001-65535 are in no bucket"},
+		},
+		{
+			name:     "overlap",
+			buckets:  []CollectorBucket{{0, 40000, "c1", "c2"}, {30000, 65535, "c2", "c1"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"bucket 30000-65535 overlaps hashes 30000-40000"},
+		},
+		{
+			name:     "bucket inside another",
+			buckets:  []CollectorBucket{{0, 65535, "c1", "c2"}, {100, 200, "c2", "c1"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"bucket 100-200 overlaps hashes 100-200"},
+		},
+		{
+			name:     "lo above hi",
+			buckets:  []CollectorBucket{{0, 65535, "c1", "c2"}, {70, 60, "c1", "c2"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"bucket 70-60 has lo above hi"},
+		},
+		{
+			name:     "outside the hash space",
+			buckets:  []CollectorBucket{{0, 70000, "c1", "c2"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"bucket 0-70000 is outside the hash space 0-65535"},
+		},
+		{
+			name:     "primary is secondary",
+			buckets:  []CollectorBucket{{0, 65535, "c1", "c1"}},
+			active:   []CollectorMessage{c1, c2},
+			failures: []string{"bucket 0-65535 has c1 as primary and secondary"},
+		},
+		{
+			name:     "primary is secondary with a single collector",
+			buckets:  []CollectorBucket{{0, 65535, "c1", "c1"}},
+			active:   []CollectorMessage{c1},
+			failures: []string{"bucket 0-65535 has c1 as primary and secondary"},
+		},
+		{
+			name:    "collectors missing, unknown, unhealthy, decommissioned or deactivated",
+			buckets: []CollectorBucket{{0, 100, "", "c1"}, {101, 200, "nobody", "c1"}, {201, 300, "sick", "c1"}, {301, 400, "gone", "c1"}, {401, 65535, "old", "c1"}},
+			active:  []CollectorMessage{c1, sick, gone},
+			failures: []string{
+				"bucket 0-100 has no primary",
+				"bucket 101-200 primary nobody is not an active collector",
+				"bucket 201-300 primary sick is not healthy",
+				"bucket 301-400 primary gone is not healthy",
+				"bucket 401-65535 primary old is deactivated",
+			},
+		},
+	}
+	for _, test := range tests {
+		var config ServerConfigMessage
+		config.Data.Buckets = test.buckets
+		config.Data.Active = test.active
+		config.Data.Deactivated = []CollectorMessage{old}
+		failures := bucketFailures(&config)
+		if len(failures) == 0 && len(test.failures) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(failures, test.failures) {
+			t.Errorf("%s: failures %q, want %q", test.name, failures, test.failures)
+		}
+	}
+}
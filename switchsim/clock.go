@@ -0,0 +1,42 @@
+package switchsim
+
+import (
+	"context"
+	"time"
+)
+
+// VirtualClock runs factor times faster than the wall clock from the moment it
+// is created, so long uptimes can be simulated in a short run.
+type VirtualClock struct {
+	start  time.Time
+	factor float64
+}
+
+func NewVirtualClock(factor float64) *VirtualClock {
+	if factor <= 0 {
+		factor = 1
+	}
+	return &VirtualClock{start: time.Now(), factor: factor}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.factor))
+}
+
+// Sleep waits for d of virtual time, it returns false if ctx is cancelled
+// first.
+func (c *VirtualClock) Sleep(ctx context.Context, d time.Duration) bool {
+	return sleep(ctx, time.Duration(float64(d)/c.factor))
+}
+
+// sleep waits for d, it returns false if ctx is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,171 @@
+package switchsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+)
+
+// Classes of websocket closes.
+const (
+	closeNormal          = "normal"          // 1000
+	closeGoingAway       = "goingAway"       // 1001
+	closePolicyViolation = "policyViolation" // 1008
+	closeAbnormal        = "abnormal"        // 1006, the connection died without a close frame
+	closeTimeout         = "timeout"         // no gateway message or pong within the read timeout
+	closeOther           = "other"           // any other code
+)
+
+// What a switch does when the gateway closes its websocket.
+const (
+	closeGiveUp     = "giveUp"     // stay down
+	closeReconnect  = "reconnect"  // open a new websocket
+	closeReregister = "reregister" // redo the https registration, then open a new websocket
+)
+
+// closeInfo is how a websocket was closed by the gateway.
+type closeInfo struct {
+	Code  int
+	Class string
+	Text  string
+}
+
+func (i closeInfo) String() string {
+	if i.Class == closeTimeout {
+		return i.Class + ": " + i.Text
+	}
+	if i.Text == "" {
+		return fmt.Sprintf("%d (%s)", i.Code, i.Class)
+	}
+	return fmt.Sprintf("%d (%s): %s", i.Code, i.Class, i.Text)
+}
+
+// classifyClose turns the error ReadMessage returned into a closeInfo.
+func classifyClose(err error) closeInfo {
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		return closeInfo{Code: websocket.CloseAbnormalClosure, Class: closeAbnormal, Text: err.Error()}
+	}
+	info := closeInfo{Code: closeErr.Code, Text: closeErr.Text}
+	switch closeErr.Code {
+	case websocket.CloseNormalClosure:
+		info.Class = closeNormal
+	case websocket.CloseGoingAway:
+		info.Class = closeGoingAway
+	case websocket.ClosePolicyViolation:
+		info.Class = closePolicyViolation
+	case websocket.CloseAbnormalClosure:
+		info.Class = closeAbnormal
+	default:
+		info.Class = closeOther
+	}
+	return info
+}
+
+// ClosePolicy maps close codes and classes to the action a switch takes,
+// parsed from e.g. "policyViolation=giveUp,abnormal=reregister,4000=reconnect".
+// A code takes precedence over its class, closes not in the policy give up.
+type ClosePolicy map[string]string
+
+func ParseClosePolicy(s string) (ClosePolicy, error) {
+	policy := make(ClosePolicy)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not code=action or class=action", entry)
+		}
+		key, action := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case closeNormal, closeGoingAway, closePolicyViolation, closeAbnormal, closeTimeout, closeOther:
+		default:
+			if _, err := strconv.Atoi(key); err != nil {
+				return nil, fmt.Errorf("unknown close code or class %q", key)
+			}
+		}
+		switch action {
+		case closeGiveUp, closeReconnect, closeReregister:
+		default:
+			return nil, fmt.Errorf("unknown close action %q", action)
+		}
+		policy[key] = action
+	}
+	return policy, nil
+}
+
+func (p ClosePolicy) action(info closeInfo) string {
+	if action, ok := p[strconv.Itoa(info.Code)]; ok {
+		return action
+	}
+	if action, ok := p[info.Class]; ok {
+		return action
+	}
+	return closeGiveUp
+}
+
+// gatewayClosed handles the gateway closing the websocket, or the connection
+// dying under it, as the close policy says.
+func (s *Switch) gatewayClosed(c *connection, err error, allToMainLoop chan string) {
+	info := classifyClose(err)
+	action := s.closePolicy.action(info)
+	glog.Infof(s.switchName + ": websocket closed by gateway, code " + info.String() + ", " + action + "\n")
+	s.mu.Lock()
+	s.stats.LastCloseCode = info.Code
+	if s.stats.GatewayCloses == nil {
+		s.stats.GatewayCloses = make(map[string]int)
+	}
+	s.stats.GatewayCloses[strconv.Itoa(info.Code)]++
+	s.mu.Unlock()
+	s.closeAction(c, action, websocket.CloseNormalClosure, "gateway closed "+info.String(), allToMainLoop)
+}
+
+// readTimedOut closes a websocket the gateway went quiet on, the close policy
+// of the timeout class says what comes next.
+func (s *Switch) readTimedOut(c *connection, allToMainLoop chan string) {
+	info := closeInfo{Class: closeTimeout, Text: fmt.Sprintf("no gateway message or pong in %v", s.readTimeout)}
+	action := s.closePolicy.action(info)
+	glog.Infof(s.switchName + ": websocket " + info.String() + ", " + action + "\n")
+	s.count(func(stats *Stats) { stats.ReadTimeouts++ })
+	s.closeAction(c, action, websocket.CloseGoingAway, info.String(), allToMainLoop)
+}
+
+// closeAction ends the session with code and reason and gives up, reconnects
+// or reregisters.
+func (s *Switch) closeAction(c *connection, action string, code int, reason string, allToMainLoop chan string) {
+	if action == closeGiveUp {
+		s.disconnected(c, code, reason, allToMainLoop)
+		return
+	}
+	if !s.drop(c, code, reason, StateReconnecting) {
+		return
+	}
+	go func() {
+		if !sleep(c.parent, s.reconnectDelay) {
+			return
+		}
+		var ok bool
+		if action == closeReregister {
+			ok = s.register(c.parent, allToMainLoop)
+		} else {
+			glog.Infof(s.switchName + ": Sending websocket request\n")
+			if ok = s.WebSocketRequest(c.parent, allToMainLoop); !ok {
+				glog.Infof(s.switchName + ": Websocket request failed\n")
+				// A switch registers with a gateway before opening a websocket to it.
+				if ok = s.failover() && s.register(c.parent, allToMainLoop); !ok {
+					s.setState(StateDown)
+				}
+			}
+		}
+		if !ok {
+			select {
+			case allToMainLoop <- s.switchName:
+			case <-c.parent.Done():
+			}
+		}
+	}()
+}
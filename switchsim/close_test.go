@@ -0,0 +1,73 @@
+package switchsim
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseClosePolicy(t *testing.T) {
+	tests := []struct {
+		spec   string
+		policy ClosePolicy
+		err    string
+	}{
+		{spec: "", policy: ClosePolicy{}},
+		{spec: " , ", policy: ClosePolicy{}},
+		{
+			spec:   "goingAway=reconnect, abnormal=reregister,4000=giveUp,timeout=reconnect",
+			policy: ClosePolicy{"goingAway": "reconnect", "abnormal": "reregister", "4000": "giveUp", "timeout": "reconnect"},
+		},
+		{spec: "normal=giveUp,normal=reconnect", policy: ClosePolicy{"normal": "reconnect"}},
+		{spec: "policyViolation=reconnect,other=reregister", policy: ClosePolicy{"policyViolation": "reconnect", "other": "reregister"}},
+		{spec: "goingAway", err: "is not code=action or class=action"},
+		{spec: "goingAway=", err: "unknown close action"},
+		{spec: "goingAway=retry", err: "unknown close action"},
+		{spec: "sometimes=reconnect", err: "unknown close code or class"},
+		{spec: "=reconnect", err: "unknown close code or class"},
+		{spec: "1001.5=reconnect", err: "unknown close code or class"},
+	}
+	for _, test := range tests {
+		policy, err := ParseClosePolicy(test.spec)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseClosePolicy(%q) error = %v, want %q", test.spec, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(policy, test.policy) {
+			t.Errorf("ParseClosePolicy(%q) = %v, %v, want %v", test.spec, policy, err, test.policy)
+		}
+	}
+}
+
+func TestClosePolicyAction(t *testing.T) {
+	policy, err := ParseClosePolicy("goingAway=reconnect,1001=reregister,abnormal=reregister,other=reconnect,4000=giveUp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		err    error
+		class  string
+		action string
+	}{
+		{&websocket.CloseError{Code: websocket.CloseNormalClosure}, closeNormal, closeGiveUp},
+		{&websocket.CloseError{Code: websocket.CloseGoingAway}, closeGoingAway, closeReregister}, // the code wins over its class
+		{&websocket.CloseError{Code: websocket.ClosePolicyViolation}, closePolicyViolation, closeGiveUp},
+		{&websocket.CloseError{Code: 4001}, closeOther, closeReconnect},
+		{&websocket.CloseError{Code: 4000}, closeOther, closeGiveUp},
+		{errors.New("connection reset by peer"), closeAbnormal, closeReregister},
+	}
+	for _, test := range tests {
+		info := classifyClose(test.err)
+		if info.Class != test.class {
+			t.Errorf("%v: class %s, want %s", test.err, info.Class, test.class)
+		}
+		if action := policy.action(info); action != test.action {
+			t.Errorf("%v: action %s, want %s", test.err, action, test.action)
+		}
+	}
+}
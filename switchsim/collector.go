@@ -0,0 +1,198 @@
+package switchsim
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SensorTally is what a stub collector got from one sensor of one switch.
+type SensorTally struct {
+	Sensor       int       `json:"sensor"`
+	Datagrams    int64     `json:"datagrams"`
+	Flows        int64     `json:"flows"`
+	Packets      int64     `json:"packets"`
+	Bytes        int64     `json:"bytes"`
+	LastSequence uint32    `json:"lastSequence"`
+	SequenceGaps int64     `json:"sequenceGaps"` // datagrams skipped in the sequence
+	Late         int64     `json:"late"`         // datagrams older than the last one, reordered or duplicated
+	First        time.Time `json:"first"`
+	Last         time.Time `json:"last"`
+	FlowRate     float64   `json:"flowRate"` // flows a second between the first and last datagram
+}
+
+// ExporterTally is what a stub collector got from one switch.
+type ExporterTally struct {
+	Serial    string        `json:"serial"`
+	Datagrams int64         `json:"datagrams"`
+	Flows     int64         `json:"flows"`
+	FlowRate  float64       `json:"flowRate"`
+	Sensors   []SensorTally `json:"sensors"`
+}
+
+// CollectorTally is what one stub collector got.
+type CollectorTally struct {
+	Name         string          `json:"name"`
+	Addrs        []string        `json:"addrs"`
+	Datagrams    int64           `json:"datagrams"`
+	DecodeErrors int64           `json:"decodeErrors"`
+	Exporters    []ExporterTally `json:"exporters"`
+}
+
+type sensorKey struct {
+	serial string
+	sensor int
+}
+
+// StubCollector receives export datagrams like a collector would and tallies
+// them, so tests can check the export path without a collector cluster.
+type StubCollector struct {
+	name     string
+	sockets  []net.PacketConn
+	received *Ledger // nil if the received flows aren't written
+	done     sync.WaitGroup
+
+	mu           sync.Mutex
+	datagrams    int64
+	decodeErrors int64
+	sensors      map[sensorKey]*SensorTally
+}
+
+// NewStubCollector listens on every address, which is usually the udp_port
+// and spine_udp_port of one collector of a config_msg. Every flow it receives
+// is written to received unless it is nil.
+func NewStubCollector(name string, addrs []string, received *Ledger) (*StubCollector, error) {
+	c := &StubCollector{name: name, received: received, sensors: make(map[sensorKey]*SensorTally)}
+	for _, addr := range addrs {
+		socket, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.sockets = append(c.sockets, socket)
+	}
+	for _, socket := range c.sockets {
+		c.done.Add(1)
+		go c.receive(socket)
+	}
+	return c, nil
+}
+
+func (c *StubCollector) Name() string {
+	return c.name
+}
+
+func (c *StubCollector) receive(socket net.PacketConn) {
+	defer c.done.Done()
+	addr := socket.LocalAddr().String()
+	b := make([]byte, 65536)
+	for {
+		n, _, err := socket.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		d, err := DecodeExport(b[:n])
+		if err != nil {
+			glog.Errorf(c.name+": Can't decode export datagram: %v\n", err)
+			c.mu.Lock()
+			c.decodeErrors++
+			c.mu.Unlock()
+			continue
+		}
+		c.tally(d, now)
+		if c.received != nil {
+			entries := make([]LedgerEntry, len(d.Records))
+			for i, r := range d.Records {
+				entries[i] = LedgerEntry{Time: now, Serial: d.Serial, Sensor: d.Sensor, Collector: c.name, Addr: addr, Sequence: d.Sequence, FlowID: r.FlowID, Flow: r.Flow}
+			}
+			c.received.record(entries)
+		}
+	}
+}
+
+func (c *StubCollector) tally(d ExportDatagram, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.datagrams++
+	key := sensorKey{d.Serial, d.Sensor}
+	t := c.sensors[key]
+	switch {
+	case t == nil: // the sequence may start anywhere, at 0 too
+		t = &SensorTally{Sensor: d.Sensor, First: now, LastSequence: d.Sequence}
+		c.sensors[key] = t
+	case d.Sequence > t.LastSequence:
+		t.SequenceGaps += int64(d.Sequence - t.LastSequence - 1)
+		t.LastSequence = d.Sequence
+	default:
+		t.Late++
+	}
+	t.Datagrams++
+	t.Last = now
+	for _, r := range d.Records {
+		t.Flows++
+		t.Packets += r.Flow.Packets
+		t.Bytes += r.Flow.Bytes
+	}
+}
+
+// Tally returns what the collector received so far, by switch and sensor.
+func (c *StubCollector) Tally() CollectorTally {
+	tally := CollectorTally{Name: c.name, Exporters: []ExporterTally{}}
+	for _, socket := range c.sockets {
+		tally.Addrs = append(tally.Addrs, socket.LocalAddr().String())
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tally.Datagrams, tally.DecodeErrors = c.datagrams, c.decodeErrors
+	exporters := make(map[string]*ExporterTally)
+	first, last := make(map[string]time.Time), make(map[string]time.Time)
+	for key, t := range c.sensors {
+		e := exporters[key.serial]
+		if e == nil {
+			e = &ExporterTally{Serial: key.serial}
+			exporters[key.serial] = e
+		}
+		sensor := *t
+		if seconds := t.Last.Sub(t.First).Seconds(); seconds > 0 {
+			sensor.FlowRate = float64(t.Flows) / seconds
+		}
+		e.Datagrams += t.Datagrams
+		e.Flows += t.Flows
+		e.Sensors = append(e.Sensors, sensor)
+		if first[key.serial].IsZero() || t.First.Before(first[key.serial]) {
+			first[key.serial] = t.First
+		}
+		if t.Last.After(last[key.serial]) {
+			last[key.serial] = t.Last
+		}
+	}
+	for serial, e := range exporters {
+		if seconds := last[serial].Sub(first[serial]).Seconds(); seconds > 0 {
+			e.FlowRate = float64(e.Flows) / seconds
+		}
+		sort.Slice(e.Sensors, func(i, j int) bool { return e.Sensors[i].Sensor < e.Sensors[j].Sensor })
+		tally.Exporters = append(tally.Exporters, *e)
+	}
+	sort.Slice(tally.Exporters, func(i, j int) bool { return tally.Exporters[i].Serial < tally.Exporters[j].Serial })
+	return tally
+}
+
+// Reset forgets everything the collector received.
+func (c *StubCollector) Reset() {
+	c.mu.Lock()
+	c.datagrams, c.decodeErrors = 0, 0
+	c.sensors = make(map[sensorKey]*SensorTally)
+	c.mu.Unlock()
+}
+
+// Close stops listening and waits for the datagrams being handled.
+func (c *StubCollector) Close() {
+	for _, socket := range c.sockets {
+		socket.Close()
+	}
+	c.done.Wait()
+}
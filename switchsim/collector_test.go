@@ -0,0 +1,37 @@
+package switchsim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStubCollectorSequences(t *testing.T) {
+	tests := []struct {
+		name      string
+		sequences []uint32
+		last      uint32
+		gaps      int64
+		late      int64
+	}{
+		{"from 1", []uint32{1, 2, 3}, 3, 0, 0},
+		{"from 0", []uint32{0, 1, 2}, 2, 0, 0},
+		{"from 0 with a gap", []uint32{0, 3}, 3, 2, 0},
+		{"late and duplicated", []uint32{5, 7, 6, 7}, 7, 1, 2},
+		{"first one only", []uint32{0}, 0, 0, 0},
+	}
+	for _, test := range tests {
+		c := &StubCollector{name: "c1", sensors: make(map[sensorKey]*SensorTally)}
+		for _, sequence := range test.sequences {
+			c.tally(ExportDatagram{Serial: "FDO1", Sensor: 2, Sequence: sequence, Records: []ExportRecord{{FlowID: 1}}}, time.Now())
+		}
+		tally := c.Tally()
+		if len(tally.Exporters) != 1 || len(tally.Exporters[0].Sensors) != 1 {
+			t.Fatalf("%s: tally %+v, want one sensor of one switch", test.name, tally)
+		}
+		sensor := tally.Exporters[0].Sensors[0]
+		if sensor.LastSequence != test.last || sensor.SequenceGaps != test.gaps || sensor.Late != test.late || sensor.Datagrams != int64(len(test.sequences)) {
+			t.Errorf("%s: last sequence %d, %d gaps, %d late, %d datagrams, want %d, %d, %d, %d", test.name,
+				sensor.LastSequence, sensor.SequenceGaps, sensor.Late, sensor.Datagrams, test.last, test.gaps, test.late, len(test.sequences))
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package switchsim
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Export datagrams carry flow records from a switch's sensor to a collector
+// over UDP. All numbers are big endian:
+//
+//	header   magic uint32 "TSF1", version uint16, records uint16,
+//	         sensor uint32 (exporter_id), sequence uint32 (per switch, sensor
+//	         and collector), exportTime int64 (unix ns), serial length uint8,
+//	         serial
+//	record   flowID uint64, srcIP [4]byte, dstIP [4]byte, srcPort uint16,
+//	         dstPort uint16, protocol uint8, 3 bytes padding, vrfID uint32,
+//	         packets uint64, bytes uint64, start int64 (unix ms),
+//	         durationMs uint32
+const (
+	exportMagic   = 0x54534631
+	exportVersion = 1
+	exportRecord  = 56
+	// maxExportRecords keeps a datagram under a 1500 byte MTU.
+	maxExportRecords = 24
+)
+
+// ExportRecord is one flow of an export datagram.
+type ExportRecord struct {
+	FlowID uint64
+	Flow   Flow
+}
+
+// ExportDatagram is what a switch sends a collector in one UDP datagram.
+type ExportDatagram struct {
+	Serial     string
+	Sensor     int
+	Sequence   uint32
+	ExportTime time.Time
+	Records    []ExportRecord
+}
+
+// Encode returns the datagram in the export format.
+func (d ExportDatagram) Encode() ([]byte, error) {
+	if len(d.Serial) > 255 || len(d.Records) > 65535 {
+		return nil, errors.New("export datagram too large")
+	}
+	b := make([]byte, 0, 25+len(d.Serial)+len(d.Records)*exportRecord)
+	b = binary.BigEndian.AppendUint32(b, exportMagic)
+	b = binary.BigEndian.AppendUint16(b, exportVersion)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(d.Records)))
+	b = binary.BigEndian.AppendUint32(b, uint32(d.Sensor))
+	b = binary.BigEndian.AppendUint32(b, d.Sequence)
+	b = binary.BigEndian.AppendUint64(b, uint64(d.ExportTime.UnixNano()))
+	b = append(b, byte(len(d.Serial)))
+	b = append(b, d.Serial...)
+	for _, r := range d.Records {
+		src, dst := net.ParseIP(r.Flow.SrcIP).To4(), net.ParseIP(r.Flow.DstIP).To4()
+		if src == nil || dst == nil {
+			return nil, fmt.Errorf("flow %d: not an IPv4 flow", r.FlowID)
+		}
+		b = binary.BigEndian.AppendUint64(b, r.FlowID)
+		b = append(b, src...)
+		b = append(b, dst...)
+		b = binary.BigEndian.AppendUint16(b, uint16(r.Flow.SrcPort))
+		b = binary.BigEndian.AppendUint16(b, uint16(r.Flow.DstPort))
+		b = append(b, byte(r.Flow.Protocol), 0, 0, 0)
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Flow.VrfID))
+		b = binary.BigEndian.AppendUint64(b, uint64(r.Flow.Packets))
+		b = binary.BigEndian.AppendUint64(b, uint64(r.Flow.Bytes))
+		b = binary.BigEndian.AppendUint64(b, uint64(r.Flow.Start.UnixNano()/int64(time.Millisecond)))
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Flow.DurationMs))
+	}
+	return b, nil
+}
+
+// DecodeExport parses a datagram in the export format. Decoded flows only
+// have the fields the format carries.
+func DecodeExport(b []byte) (ExportDatagram, error) {
+	var d ExportDatagram
+	if len(b) < 25 || binary.BigEndian.Uint32(b) != exportMagic {
+		return d, errors.New("not an export datagram")
+	}
+	if version := binary.BigEndian.Uint16(b[4:]); version != exportVersion {
+		return d, fmt.Errorf("unknown export version %d", version)
+	}
+	records := int(binary.BigEndian.Uint16(b[6:]))
+	d.Sensor = int(binary.BigEndian.Uint32(b[8:]))
+	d.Sequence = binary.BigEndian.Uint32(b[12:])
+	d.ExportTime = time.Unix(0, int64(binary.BigEndian.Uint64(b[16:])))
+	serialEnd := 25 + int(b[24])
+	if len(b) != serialEnd+records*exportRecord {
+		return d, fmt.Errorf("export datagram of %d bytes doesn't hold %d records", len(b), records)
+	}
+	d.Serial = string(b[25:serialEnd])
+	d.Records = make([]ExportRecord, records)
+	for i := range d.Records {
+		r := b[serialEnd+i*exportRecord:]
+		d.Records[i] = ExportRecord{
+			FlowID: binary.BigEndian.Uint64(r),
+			Flow: Flow{
+				SrcIP:      net.IP(r[8:12]).String(),
+				DstIP:      net.IP(r[12:16]).String(),
+				SrcPort:    int(binary.BigEndian.Uint16(r[16:])),
+				DstPort:    int(binary.BigEndian.Uint16(r[18:])),
+				Protocol:   int(r[20]),
+				VrfID:      int(binary.BigEndian.Uint32(r[24:])),
+				Packets:    int64(binary.BigEndian.Uint64(r[28:])),
+				Bytes:      int64(binary.BigEndian.Uint64(r[36:])),
+				Start:      time.Unix(0, int64(binary.BigEndian.Uint64(r[44:]))*int64(time.Millisecond)),
+				DurationMs: int64(binary.BigEndian.Uint32(r[52:])),
+			},
+		}
+	}
+	return d, nil
+}
+
+// FlowHash places a flow in the bucket hash space by its 5-tuple.
+func FlowHash(flow Flow) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%d", flow.SrcIP, flow.DstIP, flow.SrcPort, flow.DstPort, flow.Protocol)
+	return int(h.Sum32() & bucketHashMax)
+}
+
+// exportState survives reconnects, so flow IDs and datagram sequences keep
+// counting up for the life of the switch.
+type exportState struct {
+	wake      chan struct{} // a new config_msg arrived
+	mu        sync.Mutex
+	generator *FlowGenerator
+	socket    net.PacketConn
+	nextFlow  uint64
+	sequences map[exportKey]uint32
+}
+
+// exportKey is where a datagram goes.
+type exportKey struct {
+	collector string
+	sensor    int
+}
+
+// defaultExportInterval is used until a config_msg sets exportIntervalMs.
+const defaultExportInterval = time.Second
+
+// exportSchedule returns the export interval and active sensors of the last
+// config_msg, or no sensors if the switch mustn't export.
+func (s *Switch) exportSchedule() (time.Duration, []int) {
+	s.mu.Lock()
+	config := s.collectorConfig
+	s.mu.Unlock()
+	if config == nil || config.Data.DataPathDisable {
+		return defaultExportInterval, nil
+	}
+	interval := time.Duration(config.Data.CfgOpts.ExportIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultExportInterval
+	}
+	var sensors []int
+	for _, sensor := range config.Data.HwSensors {
+		if sensor.State == "active" {
+			sensors = append(sensors, sensor.ExporterID)
+		}
+	}
+	if len(sensors) == 0 {
+		sensors = []int{0}
+	}
+	return interval, sensors
+}
+
+// wakeExporter makes the exporter pick up a new config_msg right away.
+func (s *Switch) wakeExporter() {
+	select {
+	case s.export.wake <- struct{}{}:
+	default:
+	}
+}
+
+// exporter exports the switch's flows while its websocket is up. Every
+// sensor exports once per exportIntervalMs, the sensors spread over the
+// interval, and a new interval applies from the sensors' next export.
+func (s *Switch) exporter(c *connection) {
+	defer c.goroutines.Done()
+	last := make(map[int]time.Time) // export of each sensor
+	owed := make(map[int]float64)   // flows short of the rate
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	nextBurst := s.exportShape.nextMicroburst(time.Now())
+	for {
+		interval, sensors := s.exportSchedule()
+		now := time.Now()
+		next := now.Add(interval)
+		due := make(map[int]bool)
+		for i, sensor := range sensors {
+			if _, ok := last[sensor]; !ok {
+				last[sensor] = now.Add(-interval + time.Duration(i)*interval/time.Duration(len(sensors)))
+			}
+			at := last[sensor].Add(interval)
+			if !at.After(now) {
+				due[sensor] = true
+			} else if at.Before(next) {
+				next = at
+			}
+		}
+		if !nextBurst.IsZero() && nextBurst.Before(next) {
+			next = nextBurst
+		}
+		for _, sensor := range sensors {
+			if !due[sensor] {
+				continue
+			}
+			// Catching up after a stall exports one interval, not every missed one.
+			from := last[sensor]
+			if from.Before(now.Add(-interval)) {
+				from = now.Add(-interval)
+			}
+			owed[sensor] += s.exportShape.flows(float64(s.flowsPerSecond)/float64(len(sensors)), from, now)
+			n := int(owed[sensor])
+			owed[sensor] -= float64(n)
+			if !s.exportFlows(c.ctx, sensor, n) {
+				return
+			}
+			last[sensor] = now
+		}
+		if !nextBurst.IsZero() && !nextBurst.After(now) {
+			burst := s.exportShape.microburstFlows(s.flowsPerSecond)
+			glog.Infof(s.switchName+": microburst of %d flows\n", burst)
+			for i, sensor := range sensors {
+				if !s.exportFlows(c.ctx, sensor, burst/len(sensors)+boolInt(i < burst%len(sensors))) {
+					return
+				}
+			}
+			nextBurst = s.exportShape.nextMicroburst(now)
+		}
+		if len(due) > 0 || (!nextBurst.IsZero() && !nextBurst.After(now)) {
+			continue
+		}
+		timer.Reset(next.Sub(now))
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-s.export.wake:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// exportFlows sends n new flows of a sensor to the primary collectors of their
+// buckets, as the last config_msg says, and writes them to the ledger. It
+// returns false if ctx is cancelled while the rate limit holds it back.
+func (s *Switch) exportFlows(ctx context.Context, sensor int, n int) bool {
+	s.mu.Lock()
+	config := s.collectorConfig
+	s.mu.Unlock()
+	if config == nil || config.Data.DataPathDisable || n <= 0 {
+		return true
+	}
+	collectors := make(map[string]CollectorMessage)
+	for _, c := range config.Data.Active {
+		if !c.Decommissioned {
+			collectors[c.Name] = c
+		}
+	}
+
+	// The flows and the sequence numbers to go on from are taken under the
+	// lock, which isn't held while the rate limit waits.
+	e := &s.export
+	e.mu.Lock()
+	if e.socket == nil {
+		socket, err := net.ListenPacket("udp", net.JoinHostPort(s.sourceIP, "0"))
+		if err != nil {
+			e.mu.Unlock()
+			glog.Errorf(s.switchName+": Can't open export socket: %v\n", err)
+			return true
+		}
+		e.socket = socket
+	}
+	if e.generator == nil {
+		e.generator = s.FlowGenerator()
+		e.sequences = make(map[exportKey]uint32)
+	}
+	now := s.clock.Now()
+	batches := make(map[string][]ExportRecord)
+	unrouted := 0
+	for i := 0; i < n; i++ {
+		flow := e.generator.Next(now)
+		primary := primaryOf(config.Data.Buckets, FlowHash(flow))
+		e.nextFlow++
+		if _, ok := collectors[primary]; !ok {
+			unrouted++
+			continue
+		}
+		batches[primary] = append(batches[primary], ExportRecord{e.nextFlow, flow})
+	}
+	names := make([]string, 0, len(batches))
+	sequences := make(map[exportKey]uint32) // last sequence sent, per collector
+	for name := range batches {
+		names = append(names, name)
+		sequences[exportKey{name, sensor}] = e.sequences[exportKey{name, sensor}]
+	}
+	sort.Strings(names)
+	socket := e.socket
+	e.mu.Unlock()
+
+	exported, datagrams, failed, delayed := 0, 0, 0, 0
+	var entries []LedgerEntry
+	defer func() {
+		e.mu.Lock()
+		for key, sequence := range sequences {
+			if sequence > e.sequences[key] {
+				e.sequences[key] = sequence
+			}
+		}
+		e.mu.Unlock()
+		s.ledger.record(entries)
+		s.count(func(stats *Stats) {
+			stats.FlowsExported += exported
+			stats.ExportDatagrams += datagrams
+			stats.ExportFailures += failed
+			stats.FlowsUnrouted += unrouted
+			stats.ExportsDelayed += delayed
+		})
+	}()
+	for _, name := range names {
+		collector := collectors[name]
+		key := exportKey{name, sensor}
+		address := net.JoinHostPort(collector.IP, strconv.Itoa(s.exportPort(collector)))
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			glog.Errorf(s.switchName+": Can't resolve collector %s: %v\n", name, err)
+			failed += len(batches[name])
+			continue
+		}
+		records := batches[name]
+		for len(records) > 0 {
+			chunk := records[:minInt(len(records), maxExportRecords)]
+			records = records[len(chunk):]
+			d := ExportDatagram{Serial: s.switchName, Sensor: sensor, Sequence: sequences[key] + 1, Records: chunk}
+			b, err := d.Encode()
+			if err != nil {
+				glog.Errorf(s.switchName+": Can't encode export datagram: %v\n", err)
+				failed += len(chunk)
+				continue
+			}
+			if wait := s.exportShape.reserve(len(b)); wait > 0 {
+				delayed++
+				if !sleep(ctx, wait) {
+					return false
+				}
+			}
+			// The export time is only known now, after the rate limit.
+			d.ExportTime = time.Now()
+			b, _ = d.Encode()
+			if _, err = socket.WriteTo(b, addr); err != nil {
+				glog.Errorf(s.switchName+": Can't export to collector %s: %v\n", name, err)
+				failed += len(chunk)
+				continue
+			}
+			sequences[key]++
+			datagrams++
+			exported += len(chunk)
+			for _, r := range chunk {
+				entries = append(entries, LedgerEntry{Time: d.ExportTime, Serial: s.switchName, Sensor: sensor, Collector: name, Addr: address, Sequence: d.Sequence, FlowID: r.FlowID, Flow: r.Flow})
+			}
+		}
+	}
+	return true
+}
+
+// closeExport closes the export socket.
+func (s *Switch) closeExport() {
+	s.export.mu.Lock()
+	if s.export.socket != nil {
+		s.export.socket.Close()
+		s.export.socket = nil
+	}
+	s.export.mu.Unlock()
+}
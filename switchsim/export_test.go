@@ -0,0 +1,192 @@
+package switchsim
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDatagram(records int) ExportDatagram {
+	d := ExportDatagram{
+		Serial:     "FDO21422KGM",
+		Sensor:     7,
+		Sequence:   4000000000,
+		ExportTime: time.Unix(1700000000, 123456789),
+	}
+	for i := 0; i < records; i++ {
+		d.Records = append(d.Records, ExportRecord{
+			FlowID: uint64(1)<<40 + uint64(i),
+			Flow: Flow{
+				SrcIP:      "10.3.0.1",
+				DstIP:      "192.168.200.254",
+				SrcPort:    49152 + i,
+				DstPort:    443,
+				Protocol:   ProtocolTCP,
+				VrfID:      3,
+				Packets:    1 << 33,
+				Bytes:      1 << 45,
+				Start:      time.Unix(1700000000, int64(i)*int64(time.Millisecond)),
+				DurationMs: 86400000,
+			},
+		})
+	}
+	return d
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	for _, records := range []int{0, 1, maxExportRecords} {
+		sent := testDatagram(records)
+		b, err := sent.Encode()
+		if err != nil {
+			t.Fatalf("%d records: Encode() error = %v", records, err)
+		}
+		if want := 25 + len(sent.Serial) + records*exportRecord; len(b) != want {
+			t.Errorf("%d records: datagram of %d bytes, want %d", records, len(b), want)
+		}
+		received, err := DecodeExport(b)
+		if err != nil {
+			t.Fatalf("%d records: DecodeExport() error = %v", records, err)
+		}
+		if !received.ExportTime.Equal(sent.ExportTime) {
+			t.Errorf("%d records: export time %v, want %v", records, received.ExportTime, sent.ExportTime)
+		}
+		received.ExportTime = sent.ExportTime
+		for i := range received.Records {
+			if !received.Records[i].Flow.Start.Equal(sent.Records[i].Flow.Start) {
+				t.Errorf("%d records: record %d starts %v, want %v", records, i, received.Records[i].Flow.Start, sent.Records[i].Flow.Start)
+			}
+			received.Records[i].Flow.Start = sent.Records[i].Flow.Start
+		}
+		if records == 0 {
+			sent.Records = []ExportRecord{}
+		}
+		if !reflect.DeepEqual(received, sent) {
+			t.Errorf("%d records: decoded %+v, want %+v", records, received, sent)
+		}
+	}
+}
+
+func TestEncodeExportErrors(t *testing.T) {
+	d := testDatagram(1)
+	d.Records[0].Flow.SrcIP = "2001:db8::1"
+	if _, err := d.Encode(); err == nil || !strings.Contains(err.Error(), "not an IPv4 flow") {
+		t.Errorf("Encode() of an IPv6 flow error = %v", err)
+	}
+	d = testDatagram(0)
+	d.Serial = strings.Repeat("S", 256)
+	if _, err := d.Encode(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Encode() with a 256 byte serial error = %v", err)
+	}
+}
+
+func TestDecodeExportMalformed(t *testing.T) {
+	valid, err := testDatagram(2).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(change func(b []byte) []byte) []byte {
+		return change(append([]byte(nil), valid...))
+	}
+	tests := []struct {
+		name     string
+		datagram []byte
+		err      string
+	}{
+		{"empty", nil, "not an export datagram"},
+		{"short header", valid[:24], "not an export datagram"},
+		{"bad magic", with(func(b []byte) []byte { b[0] = 'X'; return b }), "not an export datagram"},
+		{"other format", []byte(`{"cmd":"switch/check_in","data":{}}`), "not an export datagram"},
+		{"unknown version", with(func(b []byte) []byte { binary.BigEndian.PutUint16(b[4:], 2); return b }), "unknown export version 2"},
+		{"truncated record", valid[:len(valid)-1], "doesn't hold 2 records"},
+		{"missing record", valid[:len(valid)-exportRecord], "doesn't hold 2 records"},
+		{"trailing bytes", append(append([]byte(nil), valid...), 0), "doesn't hold 2 records"},
+		{"record count too high", with(func(b []byte) []byte { binary.BigEndian.PutUint16(b[6:], 3); return b }), "doesn't hold 3 records"},
+		{"serial past the end", with(func(b []byte) []byte { b[24] = 255; return b[:30] }), "doesn't hold 2 records"},
+	}
+	for _, test := range tests {
+		if _, err := DecodeExport(test.datagram); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: DecodeExport() error = %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+// exportingSwitch returns a switch configured to export to a UDP collector
+// c1 listening on collector, which gets every bucket.
+func exportingSwitch(t *testing.T, collector net.PacketConn, options ...Option) *Switch {
+	s, err := NewSwitch(append([]Option{WithGateway("gw")}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ServerConfigMessage{}
+	config.Data.Buckets = []CollectorBucket{{0, bucketHashMax, "c1", "c2"}}
+	config.Data.Active = []CollectorMessage{{Name: "c1", IP: "127.0.0.1", UDPPort: collector.LocalAddr().(*net.UDPAddr).Port}}
+	s.collectorConfig = config
+	t.Cleanup(s.closeExport)
+	return s
+}
+
+func TestExportRateLimitReleasesLock(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+	s := exportingSwitch(t, collector, WithExportShape(&ExportShape{PacketsPerSecond: 0.1}))
+	ctx, cancel := context.WithCancel(context.Background())
+	exported := make(chan bool)
+	go func() { exported <- s.exportFlows(ctx, 0, 3*maxExportRecords) }()
+
+	time.Sleep(200 * time.Millisecond)
+	// The first datagram waits 10s for the rate limit, without the lock.
+	locked := make(chan struct{})
+	go func() {
+		s.export.mu.Lock()
+		s.export.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("the export state is locked while the rate limit waits")
+	}
+	cancel()
+	if <-exported {
+		t.Error("exportFlows returned true after ctx was cancelled")
+	}
+	s.export.mu.Lock()
+	sequence := s.export.sequences[exportKey{"c1", 0}]
+	s.export.mu.Unlock()
+	if sequence != 0 {
+		t.Errorf("sequence %d with no datagram sent, want 0", sequence)
+	}
+}
+
+func TestExportSequences(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+	s := exportingSwitch(t, collector)
+	for i := 0; i < 2; i++ {
+		if !s.exportFlows(context.Background(), 0, 2*maxExportRecords) {
+			t.Fatal("exportFlows failed")
+		}
+	}
+	b := make([]byte, 65536)
+	for want := uint32(1); want <= 4; want++ {
+		collector.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := collector.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := DecodeExport(b[:n])
+		if err != nil || d.Sequence != want {
+			t.Fatalf("datagram %+v, %v, want sequence %d", d.Sequence, err, want)
+		}
+	}
+}
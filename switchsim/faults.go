@@ -0,0 +1,307 @@
+package switchsim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Faults the chaos layer can inject into websocket messages.
+const (
+	faultDrop          = "drop"          // don't send the message
+	faultDelay         = "delay"         // send it delayMs late
+	faultDuplicate     = "duplicate"     // send it twice
+	faultReorder       = "reorder"       // send it after the next message
+	faultTruncate      = "truncate"      // cut it at a random byte
+	faultCorrupt       = "corrupt"       // flip random bytes
+	faultMalformed     = "malformed"     // break the JSON syntax
+	faultWrongSwitchID = "wrongSwitchId" // send it with another switch's id
+	faultSlowDrip      = "slowDrip"      // trickle it out dripBytes at a time
+	faultAbruptClose   = "abruptClose"   // close the TCP connection without a close frame instead
+)
+
+// Faults the chaos layer can inject into the https registration.
+const (
+	faultRegisterDrop        = "registerDrop"        // skip the POST and go on as if it succeeded
+	faultRegisterDelay       = "registerDelay"       // POST delayMs late
+	faultRegisterMalformed   = "registerMalformed"   // POST broken JSON
+	faultRegisterWrongSerial = "registerWrongSerial" // register under another serial
+)
+
+// FaultSpec says when a fault hits. A fault hits every n-th message if Every
+// is set, otherwise with the given probability. With Cmd, Every and After
+// count only the messages with that cmd.
+type FaultSpec struct {
+	Probability float64 `json:"probability"`
+	Every       int     `json:"every"`
+	After       int     `json:"after"` // leave the first n messages alone
+	Cmd         string  `json:"cmd"`   // only hit messages with this cmd
+}
+
+// FaultConfig is the chaos layer, loaded by the simulator with -faults, e.g.
+//
+//	{"seed": 7, "delayMs": 2000, "faults": {
+//	  "drop": {"probability": 0.05, "cmd": "switch/add_mapping"},
+//	  "abruptClose": {"every": 50},
+//	  "registerDelay": {"probability": 0.5}}}
+type FaultConfig struct {
+	Seed           int64                `json:"seed"`
+	DelayMs        int                  `json:"delayMs"`
+	DripBytes      int                  `json:"dripBytes"`
+	DripIntervalMs int                  `json:"dripIntervalMs"`
+	Faults         map[string]FaultSpec `json:"faults"`
+}
+
+func LoadFaultConfig(fileName string) (*FaultConfig, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	config := FaultConfig{DelayMs: 1000, DripBytes: 1, DripIntervalMs: 100}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// faultInjector is the chaos layer of one switch. Its random numbers are
+// seeded from the config seed and the serial, so a run can be repeated.
+type faultInjector struct {
+	config    *FaultConfig
+	rand      *rand.Rand
+	messages  int            // websocket messages seen
+	perCmd    map[string]int // websocket messages seen by cmd
+	registers int            // registrations seen
+	tcp       *dripConn      // raw connection under the current websocket
+	mu        sync.Mutex
+}
+
+func newFaultInjector(config *FaultConfig, serial string) *faultInjector {
+	h := fnv.New64a()
+	h.Write([]byte(serial))
+	return &faultInjector{config: config, rand: rand.New(rand.NewSource(config.Seed ^ int64(h.Sum64()))), perCmd: make(map[string]int)}
+}
+
+func (f *faultInjector) hits(fault string, n int, cmd string) bool {
+	spec, ok := f.config.Faults[fault]
+	if !ok || (spec.Cmd != "" && spec.Cmd != cmd) {
+		return false
+	}
+	if spec.Cmd != "" {
+		n = f.perCmd[cmd]
+	}
+	if n <= spec.After {
+		return false
+	}
+	if spec.Every > 0 {
+		return (n-spec.After)%spec.Every == 0
+	}
+	return f.rand.Float64() < spec.Probability
+}
+
+// dialer wraps the raw connection under the websocket that dial opens, so
+// slowDrip and abruptClose can get at it.
+func (f *faultInjector) dialer(dial func(ctx context.Context, network string, addr string) (net.Conn, error)) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		f.mu.Lock()
+		f.tcp = &dripConn{Conn: conn}
+		f.mu.Unlock()
+		return f.tcp, nil
+	}
+}
+
+// dripConn writes dripBytes at a time while dripping is on.
+type dripConn struct {
+	net.Conn
+	mu       sync.Mutex
+	dripping bool
+	bytes    int
+	interval time.Duration
+}
+
+func (d *dripConn) drip(on bool, bytes int, interval time.Duration) {
+	d.mu.Lock()
+	d.dripping, d.bytes, d.interval = on, bytes, interval
+	d.mu.Unlock()
+}
+
+func (d *dripConn) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	dripping, size, interval := d.dripping, d.bytes, d.interval
+	d.mu.Unlock()
+	if !dripping || size < 1 {
+		return d.Conn.Write(b)
+	}
+	written := 0
+	for written < len(b) {
+		end := written + size
+		if end > len(b) {
+			end = len(b)
+		}
+		n, err := d.Conn.Write(b[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		time.Sleep(interval)
+	}
+	return written, nil
+}
+
+func (f *faultInjector) otherSerial() string {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	serial := []byte("FDO00000000")
+	for i := 3; i < len(serial); i++ {
+		serial[i] = chars[f.rand.Intn(len(chars))]
+	}
+	return string(serial)
+}
+
+// mutate applies the payload faults to a message.
+func (f *faultInjector) mutate(switchName string, m channelMessage, n int) channelMessage {
+	message := m.Message
+	if f.hits(faultWrongSwitchID, n, m.Cmd) {
+		glog.Infof(switchName + ": fault: sending " + m.Cmd + " with a wrong switchId\n")
+		message = bytes.Replace(message, []byte("\""+switchName+"\""), []byte("\""+f.otherSerial()+"\""), -1)
+	}
+	if f.hits(faultMalformed, n, m.Cmd) && len(message) > 1 {
+		glog.Infof(switchName + ": fault: sending malformed " + m.Cmd + "\n")
+		message = append(append([]byte{}, message[:len(message)-1]...), []byte(",\"}")...)
+	}
+	if f.hits(faultTruncate, n, m.Cmd) && len(message) > 1 {
+		glog.Infof(switchName + ": fault: sending truncated " + m.Cmd + "\n")
+		message = message[:1+f.rand.Intn(len(message)-1)]
+	}
+	if f.hits(faultCorrupt, n, m.Cmd) && len(message) > 0 {
+		glog.Infof(switchName + ": fault: sending corrupted " + m.Cmd + "\n")
+		message = append([]byte{}, message...)
+		for i := 0; i < 1+len(message)/100; i++ {
+			message[f.rand.Intn(len(message))] ^= byte(1 + f.rand.Intn(255))
+		}
+	}
+	return channelMessage{m.Cmd, message}
+}
+
+// writeMessage sends a message through the chaos layer and returns the
+// messages that went out intact enough for the gateway to answer, false if a
+// write failed.
+func (s *Switch) writeMessage(c *connection, m channelMessage) ([]channelMessage, bool) {
+	f := s.faults
+	if f == nil {
+		s.observe("sent", m.Message)
+		return []channelMessage{m}, s.writeFrame(c, m.Message)
+	}
+	f.mu.Lock()
+	f.messages++
+	f.perCmd[m.Cmd]++
+	n := f.messages
+	config := f.config
+	abruptClose := f.hits(faultAbruptClose, n, m.Cmd)
+	drop := f.hits(faultDrop, n, m.Cmd)
+	reorder := f.hits(faultReorder, n, m.Cmd) && c.held == nil
+	delay := f.hits(faultDelay, n, m.Cmd)
+	duplicate := f.hits(faultDuplicate, n, m.Cmd)
+	slowDrip := f.hits(faultSlowDrip, n, m.Cmd)
+	mutated := f.mutate(s.switchName, m, n)
+	tcp := f.tcp
+	f.mu.Unlock()
+	held := c.held
+	if reorder {
+		c.held = &mutated
+	} else if !abruptClose && !drop {
+		c.held = nil
+	} else {
+		held = nil // goes out with the next message that is sent
+	}
+
+	switch {
+	case abruptClose:
+		glog.Infof(s.switchName + ": fault: closing TCP connection instead of sending " + m.Cmd + "\n")
+		if tcp != nil {
+			tcp.Conn.Close()
+		}
+		return nil, true
+	case drop:
+		glog.Infof(s.switchName + ": fault: dropping " + m.Cmd + "\n")
+		return nil, true
+	case reorder:
+		glog.Infof(s.switchName + ": fault: holding " + m.Cmd + " back until the next message\n")
+		return nil, true
+	}
+	if delay {
+		glog.Infof(s.switchName + ": fault: delaying " + m.Cmd + "\n")
+		if !sleep(c.ctx, time.Duration(config.DelayMs)*time.Millisecond) {
+			return nil, false
+		}
+	}
+	if slowDrip && tcp != nil {
+		glog.Infof(s.switchName + ": fault: slow-dripping " + m.Cmd + "\n")
+		tcp.drip(true, config.DripBytes, time.Duration(config.DripIntervalMs)*time.Millisecond)
+		defer tcp.drip(false, 0, 0)
+	}
+
+	var sent []channelMessage
+	frames := []channelMessage{mutated}
+	if duplicate {
+		glog.Infof(s.switchName + ": fault: duplicating " + m.Cmd + "\n")
+		frames = append(frames, mutated)
+	}
+	if held != nil {
+		frames = append(frames, *held)
+	}
+	for _, frame := range frames {
+		s.observe("sent", frame.Message)
+		if !s.writeFrame(c, frame.Message) {
+			return sent, false
+		}
+		if json.Valid(frame.Message) && bytes.Contains(frame.Message, []byte("\""+s.switchName+"\"")) {
+			sent = append(sent, frame)
+		}
+	}
+	return sent, true
+}
+
+// registrationFaults applies the registration faults to the request body, it
+// returns false if the POST should be skipped.
+func (s *Switch) registrationFaults(ctx context.Context, body []byte) ([]byte, bool) {
+	f := s.faults
+	if f == nil {
+		return body, true
+	}
+	f.mu.Lock()
+	f.registers++
+	n := f.registers
+	drop := f.hits(faultRegisterDrop, n, "")
+	delay := f.hits(faultRegisterDelay, n, "")
+	if f.hits(faultRegisterWrongSerial, n, "") {
+		glog.Infof(s.switchName + ": fault: registering with a wrong serial\n")
+		body = bytes.Replace(body, []byte("\""+s.switchName+"\""), []byte("\""+f.otherSerial()+"\""), -1)
+	}
+	if f.hits(faultRegisterMalformed, n, "") && len(body) > 1 {
+		glog.Infof(s.switchName + ": fault: registering with malformed JSON\n")
+		body = body[:len(body)-1]
+	}
+	delayMs := f.config.DelayMs
+	f.mu.Unlock()
+	if drop {
+		glog.Infof(s.switchName + ": fault: skipping https registration\n")
+		return body, false
+	}
+	if delay {
+		glog.Infof(s.switchName + ": fault: delaying https registration\n")
+		sleep(ctx, time.Duration(delayMs)*time.Millisecond) // the POST fails if ctx is done
+	}
+	return body, true
+}
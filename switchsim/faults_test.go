@@ -0,0 +1,114 @@
+package switchsim
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFaultHitsCountFilteredCmd(t *testing.T) {
+	cmds := []string{"check_in", "add_mapping", "add_mapping", "check_in", "add_mapping", "add_mapping", "add_mapping", "config_msg", "add_mapping"}
+	tests := []struct {
+		name string
+		spec FaultSpec
+		hits []int // indexes into cmds
+	}{
+		{"after, all cmds", FaultSpec{After: 3, Probability: 1}, []int{3, 4, 5, 6, 7, 8}},
+		{"after, one cmd", FaultSpec{After: 3, Probability: 1, Cmd: "add_mapping"}, []int{5, 6, 8}},
+		{"every, all cmds", FaultSpec{Every: 3}, []int{2, 5, 8}},
+		{"every, one cmd", FaultSpec{Every: 2, Cmd: "add_mapping"}, []int{2, 5, 8}},
+		{"after and every, one cmd", FaultSpec{After: 1, Every: 2, Cmd: "add_mapping"}, []int{4, 6}},
+		{"other cmd", FaultSpec{Every: 1, Cmd: "config_msg"}, []int{7}},
+	}
+	for _, test := range tests {
+		f := newFaultInjector(&FaultConfig{Faults: map[string]FaultSpec{faultDrop: test.spec}}, "FDO1")
+		var hits []int
+		for i, cmd := range cmds {
+			f.messages++
+			f.perCmd[cmd]++
+			if f.hits(faultDrop, f.messages, cmd) {
+				hits = append(hits, i)
+			}
+		}
+		if !reflect.DeepEqual(hits, test.hits) {
+			t.Errorf("%s: hits %v, want %v", test.name, hits, test.hits)
+		}
+	}
+}
+
+// cmds reads the cmds of the messages of a websocket session to a channel.
+func cmds(conn *websocket.Conn, received chan string) {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m SwitchMessage
+		json.Unmarshal(message, &m)
+		received <- m.Cmd
+	}
+}
+
+func TestReorderedMessageStaysInItsSession(t *testing.T) {
+	sessions := make(chan chan string, 2)
+	gateway := testGateway(t, func(conn *websocket.Conn) {
+		received := make(chan string, 20)
+		sessions <- received
+		cmds(conn, received)
+	})
+	// The last add_mapping of the first session is held back for a message
+	// that never comes.
+	faults := &FaultConfig{Faults: map[string]FaultSpec{faultReorder: {Cmd: "switch/add_mapping", After: 2, Probability: 1}}}
+	s, err := NewSwitch(WithGateway(gateway), WithFaults(faults))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startSwitch(t, s)
+	first := <-sessions
+	for i := 0; i < 4; i++ {
+		select {
+		case <-first:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d messages in the first session, want 4", i)
+		}
+	}
+	s.Disconnect()
+	startSwitch(t, s)
+	second := <-sessions
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case cmd := <-second:
+			got = append(got, cmd)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("second session got %v, want 2 messages", got)
+		}
+	}
+	if want := []string{"switch/check_in", "switch/config_msg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second session starts with %v, want %v", got, want)
+	}
+}
+
+func TestShutdownDuringDelay(t *testing.T) {
+	gateway := testGateway(t, func(conn *websocket.Conn) { cmds(conn, make(chan string, 20)) })
+	faults := &FaultConfig{DelayMs: 60000, Faults: map[string]FaultSpec{faultDelay: {Every: 1}}}
+	s, err := NewSwitch(WithGateway(gateway), WithFaults(faults))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startSwitch(t, s)
+	time.Sleep(100 * time.Millisecond) // the check-in is being delayed
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown(time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown waited for the delay fault")
+	}
+}
@@ -0,0 +1,164 @@
+package switchsim
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Fleet keeps track of every simulated switch, so switches can be added and
+// removed while the simulator runs.
+type Fleet struct {
+	ctx        context.Context // cancelled when the simulator exits
+	identities *IdentityGenerator
+	options    []Option
+	closed     chan string // allToMainLoop of every switch
+	analyzer   *AssignmentAnalyzer
+
+	mu       sync.Mutex
+	switches []*Switch // in creation order
+}
+
+// NewFleet creates an empty fleet whose switches get their identities from
+// identities and are created with options. Cancelling ctx stops them.
+func NewFleet(ctx context.Context, identities *IdentityGenerator, options ...Option) *Fleet {
+	analyzer := NewAssignmentAnalyzer()
+	options = append(append([]Option(nil), options...), OnConfig(func(s *Switch, config *ServerConfigMessage) {
+		analyzer.Observe(s.switchName, config)
+	}))
+	return &Fleet{ctx: ctx, identities: identities, options: options, closed: make(chan string, 1024), analyzer: analyzer}
+}
+
+// Assignments compares the collector assignments of the fleet's switches.
+func (f *Fleet) Assignments() AssignmentReport {
+	return f.analyzer.Report()
+}
+
+// Closed receives the serial of a switch every time it goes down. It has to be
+// drained.
+func (f *Fleet) Closed() chan string {
+	return f.closed
+}
+
+// Add creates a switch at the given place in the topology, it doesn't
+// register it.
+func (f *Fleet) Add(placement Placement) (*Switch, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if placement.HostName == "" {
+		placement.HostName = newConfig(f.options).profile.SwitchName
+	}
+	identity, err := f.identities.Next(placement.HostName, placement.IP)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSwitch(append(append([]Option(nil), f.options...), WithIdentity(identity), WithPlacement(placement))...)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof(s.switchName + ": switch " + identity.HostName + ", ip " + identity.IP + ", mac " + identity.MAC + "\n")
+	f.switches = append(f.switches, s)
+	return s, nil
+}
+
+// Start registers a switch, telling Closed if that fails. It doesn't wait for
+// Closed to be drained, so a fleet can be started before anyone reads it.
+func (f *Fleet) Start(s *Switch) {
+	if !s.register(f.ctx, f.closed) {
+		go func() {
+			select {
+			case f.closed <- s.switchName:
+			case <-f.ctx.Done():
+			}
+		}()
+	}
+}
+
+// RollingUpgrade upgrades the fleet's switches batch by batch.
+func (f *Fleet) RollingUpgrade(plan UpgradePlan) {
+	rollingUpgrade(f.ctx, f.List(), plan, f.closed)
+}
+
+// Remove disconnects a switch and drops it from the fleet.
+func (f *Fleet) Remove(serial string) bool {
+	f.mu.Lock()
+	var removed *Switch
+	for i, s := range f.switches {
+		if s.switchName == serial {
+			removed = s
+			f.switches = append(f.switches[:i], f.switches[i+1:]...)
+			break
+		}
+	}
+	f.mu.Unlock()
+	if removed == nil {
+		return false
+	}
+	removed.disconnect(StateDisconnected)
+	removed.recorder.close()
+	removed.closeExport()
+	removed.releaseSourceIP()
+	f.analyzer.Forget(serial)
+	return true
+}
+
+func (f *Fleet) Get(serial string) *Switch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.switches {
+		if s.switchName == serial {
+			return s
+		}
+	}
+	return nil
+}
+
+func (f *Fleet) List() []*Switch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Switch(nil), f.switches...)
+}
+
+// Shutdown closes every switch's websocket gracefully, giving them together
+// at most timeout to finish, and closes the session recordings.
+func (f *Fleet) Shutdown(timeout time.Duration) {
+	switches := f.List()
+	glog.Infof("Shutting down %d switches\n", len(switches))
+	// Switches failing during the shutdown still report to Closed.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-f.closed:
+			case <-done:
+				return
+			}
+		}
+	}()
+	deadline := time.Now().Add(timeout)
+	var wg sync.WaitGroup
+	for _, s := range switches {
+		wg.Add(1)
+		go func(s *Switch) {
+			defer wg.Done()
+			s.Shutdown(deadline)
+			s.recorder.close()
+		}(s)
+	}
+	wg.Wait()
+}
+
+// AllDown reports whether no switch is connected or on its way back up.
+func (f *Fleet) AllDown() bool {
+	for _, s := range f.List() {
+		switch s.State() {
+		case StateDown, StateDisconnected:
+		default:
+			return false
+		}
+	}
+	return true
+}
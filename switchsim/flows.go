@@ -0,0 +1,246 @@
+package switchsim
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Traffic profiles a flow generator mixes.
+const (
+	TrafficWeb      = "web"      // external clients to a few web servers on 80/443
+	TrafficEastWest = "eastWest" // short microservice calls inside a VRF
+	TrafficElephant = "elephant" // few long bulk transfers
+	TrafficScan     = "scan"     // one host sweeping addresses and ports
+)
+
+// IP protocol numbers.
+const (
+	ProtocolICMP = 1
+	ProtocolTCP  = 6
+	ProtocolUDP  = 17
+)
+
+// Flow is one synthetic flow seen by a switch.
+type Flow struct {
+	Profile     string    `json:"profile"`
+	SrcIP       string    `json:"srcIP"`
+	DstIP       string    `json:"dstIP"`
+	SrcPort     int       `json:"srcPort"`
+	DstPort     int       `json:"dstPort"`
+	Protocol    int       `json:"protocol"`
+	VrfID       int       `json:"vrfId"`
+	VrfName     string    `json:"vrfName"`
+	IngressPort string    `json:"ingressPort"`
+	Packets     int64     `json:"packets"`
+	Bytes       int64     `json:"bytes"`
+	Start       time.Time `json:"start"`
+	DurationMs  int64     `json:"durationMs"`
+}
+
+// TrafficMix weighs the traffic profiles of a flow generator.
+type TrafficMix map[string]int
+
+// ParseTrafficMix parses profile=weight pairs separated by commas, e.g.
+// web=3,scan=1. A profile without a weight gets weight 1.
+func ParseTrafficMix(s string) (TrafficMix, error) {
+	mix := make(TrafficMix)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		profile, weight := strings.TrimSpace(parts[0]), 1
+		switch profile {
+		case TrafficWeb, TrafficEastWest, TrafficElephant, TrafficScan:
+		default:
+			return nil, fmt.Errorf("unknown traffic profile %q", profile)
+		}
+		if len(parts) == 2 {
+			var err error
+			if weight, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || weight < 0 {
+				return nil, fmt.Errorf("%q is not profile=weight", entry)
+			}
+		}
+		mix[profile] = weight
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("no traffic profile in %q", s)
+	}
+	return mix, nil
+}
+
+// ingressPort is a port flows can enter the switch on, with its VRF.
+type ingressPort struct {
+	name    string
+	vrfID   int
+	vrfName string
+}
+
+// FlowGenerator makes flows deterministically from a seed and the switch's
+// inventory: the same seed, serial and inventory give the same flows.
+type FlowGenerator struct {
+	s        *Switch
+	rand     *rand.Rand
+	profiles []string
+	weights  []int
+	total    int
+	modTs    time.Time
+	ports    []ingressPort
+	scanner  int // host of the scan profile's source in 10.<vrf id>.250.0/24
+	scanned  int // addresses the scan profile has swept
+}
+
+// FlowGenerator returns a new generator with the switch's traffic mix, the
+// flows it makes don't depend on any generator made before.
+func (s *Switch) FlowGenerator() *FlowGenerator {
+	return s.NewFlowGenerator(s.trafficMix, s.trafficSeed)
+}
+
+// TrafficMix returns the switch's traffic mix and seed.
+func (s *Switch) TrafficMix() (TrafficMix, int64) {
+	return s.trafficMix, s.trafficSeed
+}
+
+// NewFlowGenerator returns a generator of the mix of traffic, seeded with seed
+// and the switch's serial so switches of one fleet make different flows.
+func (s *Switch) NewFlowGenerator(mix TrafficMix, seed int64) *FlowGenerator {
+	h := fnv.New64a()
+	h.Write([]byte(s.switchName))
+	g := &FlowGenerator{s: s, rand: rand.New(rand.NewSource(seed ^ int64(h.Sum64())))}
+	if len(mix) == 0 {
+		mix = TrafficMix{TrafficWeb: 1}
+	}
+	for profile := range mix {
+		g.profiles = append(g.profiles, profile)
+	}
+	sort.Strings(g.profiles)
+	for _, profile := range g.profiles {
+		g.weights = append(g.weights, mix[profile])
+		g.total += mix[profile]
+	}
+	if g.total == 0 {
+		for i := range g.weights {
+			g.weights[i] = 1
+		}
+		g.total = len(g.weights)
+	}
+	g.scanner = 1 + g.rand.Intn(254)
+	return g
+}
+
+// ingressPorts returns the ports of PORT2VRF that aren't down in PORT, with
+// the IDs of their VRF. The management VRF carries no data traffic.
+func (g *FlowGenerator) ingressPorts() []ingressPort {
+	s := g.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g.ports != nil && g.modTs.Equal(s.modTs) {
+		return g.ports
+	}
+	vrfIDs := make(map[string]int)
+	down := make(map[string]bool)
+	var port2vrf []Mapping
+	for _, c := range s.inventory {
+		for _, m := range c.Mappings {
+			switch c.Component {
+			case "VRF":
+				vrfIDs[m.Name], _ = strconv.Atoi(m.ID)
+			case "PORT":
+				down[m.Name] = m.OperSt == "down"
+			case "PORT2VRF":
+				port2vrf = append(port2vrf, m)
+			}
+		}
+	}
+	g.ports = []ingressPort{}
+	for _, m := range port2vrf {
+		if down[m.PortName] || m.VrfName == "management" {
+			continue
+		}
+		g.ports = append(g.ports, ingressPort{m.PortName, vrfIDs[m.VrfName], m.VrfName})
+	}
+	if len(g.ports) == 0 {
+		g.ports = append(g.ports, ingressPort{"eth1/1", 1, "default"})
+	}
+	g.modTs = s.modTs
+	return g.ports
+}
+
+// Next returns the next flow, starting at now.
+func (g *FlowGenerator) Next(now time.Time) Flow {
+	r := g.rand
+	pick := r.Intn(g.total)
+	profile := g.profiles[len(g.profiles)-1]
+	for i, weight := range g.weights {
+		if pick < weight {
+			profile = g.profiles[i]
+			break
+		}
+		pick -= weight
+	}
+	ports := g.ingressPorts()
+	port := ports[r.Intn(len(ports))]
+	flow := Flow{Profile: profile, VrfID: port.vrfID, VrfName: port.vrfName, IngressPort: port.name, Start: now, Protocol: ProtocolTCP}
+	// Hosts of a VRF are in 10.<vrf id>.0.0/16.
+	host := func(subnet int, hosts int) string {
+		n := r.Intn(hosts)
+		return fmt.Sprintf("10.%d.%d.%d", port.vrfID%256, subnet, 1+n)
+	}
+	// pair returns two different hosts of a subnet.
+	pair := func(subnet int, hosts int) (string, string) {
+		src := r.Intn(hosts)
+		dst := (src + 1 + r.Intn(hosts-1)) % hosts
+		prefix := fmt.Sprintf("10.%d.%d.", port.vrfID%256, subnet)
+		return prefix + strconv.Itoa(1+src), prefix + strconv.Itoa(1+dst)
+	}
+	ephemeral := func() int { return 32768 + r.Intn(28232) }
+	var packetSize int
+	switch profile {
+	case TrafficWeb:
+		flow.SrcIP = fmt.Sprintf("198.%d.%d.%d", 18+r.Intn(2), r.Intn(256), 1+r.Intn(254))
+		flow.DstIP = host(1, 8)
+		flow.SrcPort = ephemeral()
+		flow.DstPort = []int{443, 443, 443, 80}[r.Intn(4)]
+		flow.Packets = int64(5 + r.Intn(60))
+		packetSize = 200 + r.Intn(1200)
+		flow.DurationMs = int64(10 + r.Intn(3000))
+	case TrafficEastWest:
+		flow.SrcIP, flow.DstIP = pair(2, 50)
+		flow.SrcPort = ephemeral()
+		flow.DstPort = []int{8080, 9090, 6379, 5432, 3306, 9092, 2379, 50051, 53}[r.Intn(9)]
+		if flow.DstPort == 53 {
+			flow.Protocol = ProtocolUDP
+		}
+		flow.Packets = int64(2 + r.Intn(200))
+		packetSize = 100 + r.Intn(1100)
+		flow.DurationMs = int64(1 + r.Intn(2000))
+	case TrafficElephant:
+		flow.SrcIP, flow.DstIP = pair(3, 8)
+		flow.SrcPort = ephemeral()
+		flow.DstPort = []int{22, 445, 873, 2049, 5001}[r.Intn(5)]
+		flow.Packets = int64(100000 + r.Intn(10000000))
+		packetSize = 1400 + r.Intn(100)
+		flow.DurationMs = int64(30000 + r.Intn(1800000))
+	case TrafficScan:
+		flow.SrcIP = fmt.Sprintf("10.%d.250.%d", port.vrfID%256, g.scanner)
+		flow.DstIP = fmt.Sprintf("10.%d.%d.%d", port.vrfID%256, g.scanned/254%256, 1+g.scanned%254)
+		flow.SrcPort = ephemeral()
+		flow.DstPort = []int{22, 80, 443, 445, 3389, 8080, 161, 0}[g.scanned%8]
+		switch flow.DstPort {
+		case 161:
+			flow.Protocol = ProtocolUDP
+		case 0:
+			flow.Protocol, flow.SrcPort = ProtocolICMP, 0 // echo request
+		}
+		g.scanned++
+		flow.Packets = 1
+		packetSize = 44 + r.Intn(17)
+	}
+	flow.Bytes = flow.Packets * int64(packetSize)
+	return flow
+}
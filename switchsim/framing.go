@@ -0,0 +1,76 @@
+package switchsim
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+)
+
+// Websocket frame types a switch sends its JSON messages in.
+const (
+	FramingBinary = "binary" // what the simulator always sent, the default
+	FramingText   = "text"
+)
+
+// ParseFraming checks a framing, empty stands for FramingBinary.
+func ParseFraming(framing string) (string, error) {
+	switch framing {
+	case "", FramingBinary:
+		return FramingBinary, nil
+	case FramingText:
+		return FramingText, nil
+	}
+	return "", fmt.Errorf("unknown framing %q, binary or text", framing)
+}
+
+// frameType is the websocket message type of a framing.
+func frameType(framing string) int {
+	if framing == FramingText {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func frameName(messageType int) string {
+	switch messageType {
+	case websocket.TextMessage:
+		return FramingText
+	case websocket.BinaryMessage:
+		return FramingBinary
+	}
+	return fmt.Sprintf("type %d", messageType)
+}
+
+// checkFraming records the frame type of a gateway message and checks it is
+// valid UTF-8 and framed like the switch's messages. It returns the close code
+// and reason for strict framing, or 0 if the message is fine.
+func (s *Switch) checkFraming(messageType int, message []byte) (int, string) {
+	code, reason := 0, ""
+	s.mu.Lock()
+	if messageType == websocket.TextMessage {
+		s.stats.TextFramesReceived++
+	} else {
+		s.stats.BinaryFramesReceived++
+	}
+	if !utf8.Valid(message) {
+		s.stats.InvalidUTF8++
+		code, reason = websocket.CloseInvalidFramePayloadData, "gateway sent a message that isn't UTF-8"
+	}
+	if messageType != frameType(s.framing) {
+		s.stats.FramingMismatches++
+		mismatch := "gateway sent a " + frameName(messageType) + " frame to a " + s.framing + " switch"
+		if code == 0 {
+			code, reason = websocket.CloseUnsupportedData, mismatch
+		} else {
+			reason += ", " + mismatch // the close code is of the first failure
+		}
+	}
+	s.mu.Unlock()
+	if code == 0 || !s.strictFraming {
+		return 0, "" // counted only
+	}
+	glog.Errorf(s.switchName + ": " + reason + "\n")
+	return code, reason
+}
@@ -0,0 +1,86 @@
+package switchsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFraming(t *testing.T) {
+	checkIn := []byte(`{"cmd":"switch/check_in","responseCode":200}`)
+	notUTF8 := []byte("{\"cmd\":\"switch/check_in\",\"responseCode\":200,\"x\":\"\xff\xfe\"}")
+	tests := []struct {
+		name        string
+		messageType int
+		message     []byte
+		strict      bool
+		text, bin   int // frames received
+		mismatches  int
+		invalidUTF8 int
+		code        int    // the switch closes with
+		reason      string // of the close, empty if the switch stays connected
+	}{
+		{"binary", websocket.BinaryMessage, checkIn, true, 0, 1, 0, 0, 0, ""},
+		{"text, counted", websocket.TextMessage, checkIn, false, 1, 0, 1, 0, 0, ""},
+		{"text, strict", websocket.TextMessage, checkIn, true, 1, 0, 1, 0, websocket.CloseUnsupportedData, "gateway sent a text frame to a binary switch"},
+		{"not UTF-8, counted", websocket.BinaryMessage, notUTF8, false, 0, 1, 0, 1, 0, ""},
+		{"not UTF-8, strict", websocket.BinaryMessage, notUTF8, true, 0, 1, 0, 1, websocket.CloseInvalidFramePayloadData, "gateway sent a message that isn't UTF-8"},
+		{"both, strict", websocket.TextMessage, notUTF8, true, 1, 0, 1, 1, websocket.CloseInvalidFramePayloadData, "gateway sent a message that isn't UTF-8, gateway sent a text frame to a binary switch"},
+	}
+	for _, test := range tests {
+		closes := make(chan int, 1)
+		gateway := testGateway(t, func(conn *websocket.Conn) {
+			conn.ReadMessage()
+			conn.WriteMessage(test.messageType, test.message)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					if closeErr, ok := err.(*websocket.CloseError); ok {
+						closes <- closeErr.Code
+					}
+					return
+				}
+			}
+		})
+		s, err := NewSwitch(WithGateway(gateway), WithFraming(FramingBinary, test.strict))
+		if err != nil {
+			t.Fatal(err)
+		}
+		down := startSwitch(t, s)
+		var stats Stats
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if stats = s.Stats(); stats.TextFramesReceived+stats.BinaryFramesReceived > 0 {
+				break
+			}
+		}
+		if stats.TextFramesReceived != test.text || stats.BinaryFramesReceived != test.bin || stats.FramingMismatches != test.mismatches || stats.InvalidUTF8 != test.invalidUTF8 {
+			t.Errorf("%s: %d text, %d binary frames, %d mismatches, %d not UTF-8, want %d, %d, %d, %d", test.name,
+				stats.TextFramesReceived, stats.BinaryFramesReceived, stats.FramingMismatches, stats.InvalidUTF8,
+				test.text, test.bin, test.mismatches, test.invalidUTF8)
+		}
+		if test.reason == "" {
+			time.Sleep(50 * time.Millisecond)
+			if state := s.State(); state != StateConnected {
+				t.Errorf("%s: switch %s, want %s", test.name, state, StateConnected)
+			}
+			s.Disconnect()
+			continue
+		}
+		select {
+		case <-down:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the switch stayed connected", test.name)
+		}
+		if reason := s.Stats().LastCloseReason; reason != test.reason {
+			t.Errorf("%s: closed for %q, want %q", test.name, reason, test.reason)
+		}
+		select {
+		case code := <-closes:
+			if code != test.code {
+				t.Errorf("%s: closed with code %d, want %d", test.name, code, test.code)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: no close frame reached the gateway", test.name)
+		}
+	}
+}
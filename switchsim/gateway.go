@@ -0,0 +1,166 @@
+package switchsim
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// How a gateway pool assigns switches to its gateways.
+const (
+	AssignRoundRobin = "roundRobin"
+	AssignHash       = "hash" // by serial, so a switch keeps its gateway across runs
+)
+
+// Gateway is one member of a gateway cluster.
+type Gateway struct {
+	Register  string `json:"register"`  // host[:port] of the https registration
+	Websocket string `json:"websocket"` // host[:port] of the websocket
+}
+
+func (g Gateway) String() string {
+	if g.Register == g.Websocket {
+		return g.Register
+	}
+	return g.Register + "/" + g.Websocket
+}
+
+func (g Gateway) registerURL() url.URL {
+	return url.URL{Scheme: "https", Host: g.Register, Path: "/switch_register"}
+}
+
+func (g Gateway) websocketURL() url.URL {
+	return url.URL{Scheme: "wss", Host: g.Websocket, Path: "/switch_wss"}
+}
+
+// GatewayPool is the gateways switches register with. A switch starts with
+// the gateway it is assigned and fails over to the next one when registration
+// or the websocket dial fails. Give every switch of a fleet the same pool, the
+// round robin is shared.
+type GatewayPool struct {
+	Gateways   []Gateway
+	Assignment string // AssignRoundRobin or AssignHash
+	next       uint32
+}
+
+// ParseGatewayPool parses gateways separated by commas, each host[:port] for
+// both the registration and the websocket, or register/websocket for
+// separate endpoints, e.g. gw1:443,gw2:443/gw2:8443.
+func ParseGatewayPool(s string, assignment string) (*GatewayPool, error) {
+	switch assignment {
+	case AssignRoundRobin, AssignHash:
+	default:
+		return nil, fmt.Errorf("unknown gateway assignment %q", assignment)
+	}
+	pool := &GatewayPool{Assignment: assignment}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "/", 2)
+		g := Gateway{Register: bracketIPv6(parts[0]), Websocket: bracketIPv6(parts[0])}
+		if len(parts) == 2 {
+			g.Websocket = bracketIPv6(parts[1])
+		}
+		if g.Register == "" || g.Websocket == "" {
+			return nil, fmt.Errorf("%q is not host[:port] or register/websocket", entry)
+		}
+		pool.Gateways = append(pool.Gateways, g)
+	}
+	if len(pool.Gateways) == 0 {
+		return nil, fmt.Errorf("no gateway in %q", s)
+	}
+	return pool, nil
+}
+
+// Resolve replaces every gateway whose registration and websocket are on one
+// DNS name by a gateway per address the name resolves to, so the switches
+// spread over and fail over between all of them.
+func (p *GatewayPool) Resolve(ctx context.Context) error {
+	var gateways []Gateway
+	for _, g := range p.Gateways {
+		registerHost, registerPort := splitHostPort(g.Register)
+		websocketHost, websocketPort := splitHostPort(g.Websocket)
+		if registerHost != websocketHost || net.ParseIP(registerHost) != nil {
+			gateways = append(gateways, g)
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, registerHost)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			gateways = append(gateways, Gateway{Register: joinHostPort(addr, registerPort), Websocket: joinHostPort(addr, websocketPort)})
+		}
+		glog.Infof("Gateway %s resolves to %s\n", registerHost, strings.Join(addrs, ", "))
+	}
+	p.Gateways = gateways
+	return nil
+}
+
+// bracketIPv6 puts a bare IPv6 address in brackets, so it can go in a URL.
+func bracketIPv6(hostPort string) string {
+	hostPort = strings.TrimSpace(hostPort)
+	if ip := net.ParseIP(hostPort); ip != nil && ip.To4() == nil {
+		return "[" + hostPort + "]"
+	}
+	return hostPort
+}
+
+// splitHostPort splits host[:port], the port is empty if there is none.
+func splitHostPort(hostPort string) (string, string) {
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		return host, port
+	}
+	return strings.Trim(hostPort, "[]"), ""
+}
+
+func joinHostPort(host string, port string) string {
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// assign returns the index of the gateway a new switch starts with.
+func (p *GatewayPool) assign(serial string) int {
+	if p.Assignment == AssignHash {
+		h := fnv.New32a()
+		h.Write([]byte(serial))
+		return int(h.Sum32() % uint32(len(p.Gateways)))
+	}
+	return int((atomic.AddUint32(&p.next, 1) - 1) % uint32(len(p.Gateways)))
+}
+
+// gateway returns the gateway the switch uses now.
+func (s *Switch) gateway() Gateway {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gateways.Gateways[s.gatewayIndex]
+}
+
+// failover moves the switch to the next gateway of its pool, it returns false
+// if the pool has no other gateway.
+func (s *Switch) failover() bool {
+	s.mu.Lock()
+	if len(s.gateways.Gateways) < 2 {
+		s.mu.Unlock()
+		return false
+	}
+	from := s.gateways.Gateways[s.gatewayIndex]
+	s.gatewayIndex = (s.gatewayIndex + 1) % len(s.gateways.Gateways)
+	to := s.gateways.Gateways[s.gatewayIndex]
+	s.stats.GatewayFailovers++
+	s.mu.Unlock()
+	glog.Infof(s.switchName + ": failing over from gateway " + from.String() + " to " + to.String() + "\n")
+	return true
+}
@@ -0,0 +1,118 @@
+package switchsim
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseGatewayPool(t *testing.T) {
+	tests := []struct {
+		spec       string
+		assignment string
+		gateways   []Gateway
+		err        string
+	}{
+		{spec: "gw1", assignment: AssignRoundRobin, gateways: []Gateway{{"gw1", "gw1"}}},
+		{spec: " gw1:443 , gw2:443/gw2:8443 ,", assignment: AssignHash, gateways: []Gateway{{"gw1:443", "gw1:443"}, {"gw2:443", "gw2:8443"}}},
+		{spec: "[2001:db8::1]:443,10.0.0.1", assignment: AssignRoundRobin, gateways: []Gateway{{"[2001:db8::1]:443", "[2001:db8::1]:443"}, {"10.0.0.1", "10.0.0.1"}}},
+		{spec: "2001:db8::1/2001:db8::2", assignment: AssignRoundRobin, gateways: []Gateway{{"[2001:db8::1]", "[2001:db8::2]"}}},
+		{spec: "", assignment: AssignRoundRobin, err: "no gateway"},
+		{spec: " , ", assignment: AssignRoundRobin, err: "no gateway"},
+		{spec: "gw1/", assignment: AssignRoundRobin, err: "is not host[:port] or register/websocket"},
+		{spec: "/gw1", assignment: AssignRoundRobin, err: "is not host[:port] or register/websocket"},
+		{spec: "gw1", assignment: "random", err: "unknown gateway assignment"},
+		{spec: "gw1", assignment: "", err: "unknown gateway assignment"},
+	}
+	for _, test := range tests {
+		pool, err := ParseGatewayPool(test.spec, test.assignment)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseGatewayPool(%q, %q) error = %v, want %q", test.spec, test.assignment, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseGatewayPool(%q, %q) error = %v", test.spec, test.assignment, err)
+			continue
+		}
+		if !reflect.DeepEqual(pool.Gateways, test.gateways) || pool.Assignment != test.assignment {
+			t.Errorf("ParseGatewayPool(%q, %q) = %+v, want %+v", test.spec, test.assignment, pool, test.gateways)
+		}
+	}
+}
+
+func TestGatewayAssignment(t *testing.T) {
+	pool, err := ParseGatewayPool("gw0,gw1,gw2", AssignRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for i := 0; i < 5; i++ {
+		got = append(got, pool.assign("any"))
+	}
+	if want := []int{0, 1, 2, 0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("round robin assigns %v, want %v", got, want)
+	}
+	pool.Assignment = AssignHash
+	spread := make(map[int]bool)
+	for _, serial := range []string{"FDO1", "FDO2", "FDO3", "FDO4", "FDO5", "FDO6", "FDO7", "FDO8"} {
+		first := pool.assign(serial)
+		if again := pool.assign(serial); again != first {
+			t.Errorf("hash assigns %s to %d, then %d", serial, first, again)
+		}
+		spread[first] = true
+	}
+	if len(spread) < 2 {
+		t.Errorf("hash assigns 8 serials to %d gateways", len(spread))
+	}
+}
+
+func TestGatewayFailoverOrder(t *testing.T) {
+	var mu sync.Mutex
+	var tried []string
+	pool := &GatewayPool{Assignment: AssignRoundRobin, next: 1}
+	for _, name := range []string{"gw0", "gw1", "gw2"} {
+		name := name
+		gateway := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			tried = append(tried, name)
+			mu.Unlock()
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer gateway.Close()
+		host := strings.TrimPrefix(gateway.URL, "https://")
+		pool.Gateways = append(pool.Gateways, Gateway{Register: host, Websocket: host})
+	}
+	s, err := NewSwitch(WithGatewayPool(pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.register(context.Background(), make(chan string, 1)) {
+		t.Fatal("register succeeded with every gateway failing")
+	}
+	if want := []string{"gw1", "gw2", "gw0"}; !reflect.DeepEqual(tried, want) {
+		t.Errorf("tried gateways %v, want %v", tried, want)
+	}
+	if failovers := s.Stats().GatewayFailovers; failovers != 2 {
+		t.Errorf("%d failovers, want 2", failovers)
+	}
+	if s.Status().State != StateDown || s.gateway() != pool.Gateways[0] {
+		t.Errorf("switch %s on gateway %s, want down on %s", s.Status().State, s.gateway(), pool.Gateways[0])
+	}
+	if !s.failover() || s.gateway() != pool.Gateways[1] {
+		t.Errorf("failover from the last gateway went to %s, want %s", s.gateway(), pool.Gateways[1])
+	}
+
+	single, err := NewSwitch(WithGateway("gw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.failover() {
+		t.Error("failover with a single gateway succeeded")
+	}
+}
@@ -0,0 +1,121 @@
+package switchsim
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SwitchIdentity is what tells simulated switches apart.
+type SwitchIdentity struct {
+	Serial   string // also the switchId
+	HostName string // switch_name
+	IP       string // management IP, empty if none was assigned
+	MAC      string
+}
+
+// Manufacturing sites that show up as the first letters of Cisco serials.
+var serialSites = []string{"FDO", "FOC", "JAF", "SAL", "SSI"}
+
+// IdentityGenerator hands out identities deterministically from a seed, so a
+// failing run can be repeated with the same switches.
+type IdentityGenerator struct {
+	rand      *rand.Rand
+	sequence  int
+	subnet    *net.IPNet
+	broadcast bool // the subnet's last address is its broadcast address
+	nextIP    net.IP
+	hostNames map[string]int
+	macs      map[string]bool
+}
+
+// NewIdentityGenerator assigns management IPs from cidr, or none if cidr is
+// empty.
+func NewIdentityGenerator(seed int64, cidr string) (*IdentityGenerator, error) {
+	g := &IdentityGenerator{
+		rand:      rand.New(rand.NewSource(seed)),
+		hostNames: make(map[string]int),
+		macs:      make(map[string]bool),
+	}
+	if cidr != "" {
+		ip, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		g.subnet = subnet
+		ones, bits := subnet.Mask.Size()
+		g.broadcast = bits == 32 && ones < 31
+		g.nextIP = ip.Mask(subnet.Mask)
+		if ip.Equal(g.nextIP) {
+			g.nextIP = incrementIP(g.nextIP) // skip the network address
+		} else {
+			g.nextIP = ip
+		}
+	}
+	return g, nil
+}
+
+// serial builds a Cisco style serial LLLYYWWSSSS: site, manufacturing year
+// counted from 1996, week and a base 36 sequence number.
+func (g *IdentityGenerator) serial() string {
+	site := serialSites[g.rand.Intn(len(serialSites))]
+	year := 2014 + g.rand.Intn(8) - 1996
+	week := 1 + g.rand.Intn(52)
+	g.sequence++
+	sequence := strings.ToUpper(strconv.FormatInt(int64(g.sequence)+36*36*36, 36))
+	return fmt.Sprintf("%s%02d%02d%s", site, year, week, sequence[len(sequence)-4:])
+}
+
+func (g *IdentityGenerator) mac() string {
+	for {
+		mac := fmt.Sprintf("00:2a:6a:%02x:%02x:%02x", g.rand.Intn(256), g.rand.Intn(256), g.rand.Intn(256))
+		if !g.macs[mac] {
+			g.macs[mac] = true
+			return mac
+		}
+	}
+}
+
+func (g *IdentityGenerator) ip() (string, error) {
+	if g.subnet == nil {
+		return "", nil
+	}
+	if !g.subnet.Contains(g.nextIP) || (g.broadcast && !g.subnet.Contains(incrementIP(g.nextIP))) {
+		return "", fmt.Errorf("management subnet %v is exhausted", g.subnet)
+	}
+	ip := g.nextIP
+	g.nextIP = incrementIP(ip)
+	return ip.String(), nil
+}
+
+// Next returns the identity of the next switch. The switch is named hostName,
+// with a -<n> suffix if the name is already taken, and keeps ip if the
+// topology gave it one.
+func (g *IdentityGenerator) Next(hostName string, ip string) (SwitchIdentity, error) {
+	identity := SwitchIdentity{Serial: g.serial(), HostName: hostName, IP: ip, MAC: g.mac()}
+	g.hostNames[hostName]++
+	if n := g.hostNames[hostName]; n > 1 {
+		identity.HostName = fmt.Sprintf("%s-%d", hostName, n)
+	}
+	if identity.IP == "" {
+		var err error
+		if identity.IP, err = g.ip(); err != nil {
+			return identity, err
+		}
+	}
+	return identity, nil
+}
+
+func incrementIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
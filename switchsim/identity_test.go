@@ -0,0 +1,46 @@
+package switchsim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIdentityGeneratorIPs(t *testing.T) {
+	tests := []struct {
+		cidr string
+		ips  []string
+	}{
+		{"10.1.0.0/30", []string{"10.1.0.1", "10.1.0.2"}},
+		{"10.1.0.2/30", []string{"10.1.0.2"}},
+		{"10.1.0.0/31", []string{"10.1.0.1"}},
+		{"10.1.0.255/24", nil},
+		{"2001:db8::/126", []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+	}
+	for _, test := range tests {
+		g, err := NewIdentityGenerator(1, test.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ips []string
+		for {
+			identity, err := g.Next("leaf", "")
+			if err != nil {
+				break
+			}
+			ips = append(ips, identity.IP)
+			if len(ips) > 10 {
+				break
+			}
+		}
+		if !reflect.DeepEqual(ips, test.ips) {
+			t.Errorf("%s hands out %v, want %v", test.cidr, ips, test.ips)
+		}
+	}
+	g, err := NewIdentityGenerator(1, "10.1.0.0/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity, err := g.Next("leaf", "192.168.0.9"); err != nil || identity.IP != "192.168.0.9" {
+		t.Errorf("Next with an ip from the topology = %+v, %v, want 192.168.0.9", identity, err)
+	}
+}
@@ -0,0 +1,146 @@
+package switchsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+const (
+	MappingAdd    = "add"
+	MappingDelete = "delete"
+)
+
+// inventoryComponent is the VRF, PORT or PORT2VRF state a switch reports with
+// switch/add_mapping.
+type inventoryComponent struct {
+	Component string
+	Mappings  []Mapping
+}
+
+// loadInventory reads the switch's inventory from the profile's add_mapping
+// messages, keeping the order the profile sends them in.
+func (s *Switch) loadInventory() error {
+	var components []inventoryComponent
+	for _, m := range s.profile.AddMappings {
+		var addMapping SwitchAddMappingMessage
+		if err := json.Unmarshal(s.profile.render(m, s.switchName, s.identity.HostName), &addMapping); err != nil {
+			return err
+		}
+		// Profiles captured from real switches are kept as they are, only
+		// mappings changed at runtime must pass checkMapping.
+		for _, mapping := range addMapping.Data.Mappings {
+			if err := checkMapping(addMapping.Data.Component, mapping); err != nil {
+				glog.Infof(s.switchName + ": profile mapping kept unchecked: " + err.Error() + "\n")
+			}
+		}
+		components = append(components, inventoryComponent{addMapping.Data.Component, addMapping.Data.Mappings})
+	}
+	s.mu.Lock()
+	s.inventory = components
+	s.mu.Unlock()
+	return nil
+}
+
+// checkMapping returns an error if the mapping isn't one a switch reports for
+// the component: a delete needs only the dn, an add the fields the gateway
+// reads for it.
+func checkMapping(component string, mapping Mapping) error {
+	if component != "VRF" && component != "PORT" && component != "PORT2VRF" {
+		return fmt.Errorf("unknown mapping component %q", component)
+	}
+	if mapping.Oper != MappingAdd && mapping.Oper != MappingDelete {
+		return fmt.Errorf("unknown mapping oper %q", mapping.Oper)
+	}
+	if mapping.Dn == "" {
+		return fmt.Errorf("%s mapping has no dn", component)
+	}
+	if mapping.Oper == MappingDelete {
+		return nil
+	}
+	var missing string
+	switch {
+	case component == "VRF" && mapping.Name == "":
+		missing = "name"
+	case component == "VRF":
+		if _, err := strconv.Atoi(mapping.ID); err != nil {
+			return fmt.Errorf("VRF mapping %s: id %q is not a number", mapping.Dn, mapping.ID)
+		}
+	case component == "PORT" && mapping.Name == "":
+		missing = "name"
+	case component == "PORT" && mapping.OperSt == "":
+		missing = "operSt"
+	case component == "PORT2VRF" && mapping.PortName == "":
+		missing = "portName"
+	case component == "PORT2VRF" && mapping.VrfName == "":
+		missing = "vrfName"
+	}
+	if missing != "" {
+		return fmt.Errorf("%s mapping %s has no %s", component, mapping.Dn, missing)
+	}
+	return nil
+}
+
+func (s *Switch) addMappingMessage(component string, mappings []Mapping) []byte {
+	var addMapping SwitchAddMappingMessage
+	addMapping.Cmd = "switch/add_mapping"
+	addMapping.SwitchID = s.switchName
+	addMapping.Data.Component = component
+	addMapping.Data.Mappings = mappings
+	message, _ := s.marshalMessage(addMapping.Cmd, addMapping)
+	return message
+}
+
+func (s *Switch) AddMappingMessages() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([][]byte, 0, len(s.inventory))
+	for _, c := range s.inventory {
+		if message := s.addMappingMessage(c.Component, c.Mappings); message != nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// ChangeMapping adds, replaces (same dn) or deletes a mapping of the
+// inventory and returns the add_mapping message that reports the change.
+func (s *Switch) ChangeMapping(component string, mapping Mapping) ([]byte, error) {
+	if err := checkMapping(component, mapping); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var c *inventoryComponent
+	for i := range s.inventory {
+		if s.inventory[i].Component == component {
+			c = &s.inventory[i]
+			break
+		}
+	}
+	if c == nil {
+		s.inventory = append(s.inventory, inventoryComponent{Component: component})
+		c = &s.inventory[len(s.inventory)-1]
+	}
+	j := -1
+	for k, m := range c.Mappings {
+		if m.Dn == mapping.Dn {
+			j = k
+			break
+		}
+	}
+	switch {
+	case mapping.Oper == MappingDelete && j < 0:
+		return nil, fmt.Errorf("no %s mapping with dn %s", component, mapping.Dn)
+	case mapping.Oper == MappingDelete:
+		c.Mappings = append(c.Mappings[:j], c.Mappings[j+1:]...)
+	case j >= 0:
+		c.Mappings[j] = mapping
+	default:
+		c.Mappings = append(c.Mappings, mapping)
+	}
+	s.modTs = s.clock.Now()
+	return s.addMappingMessage(component, []Mapping{mapping}), nil
+}
@@ -0,0 +1,68 @@
+package switchsim
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChangeMapping(t *testing.T) {
+	s, err := NewSwitch(WithGateway("gw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		component string
+		mapping   Mapping
+		err       string
+	}{
+		{"VRF", Mapping{Oper: MappingAdd, Dn: "sys/inst-red", Name: "red", ID: "40"}, ""},
+		{"PORT", Mapping{Oper: MappingAdd, Dn: "sys/intf/phys-[eth1/60]/phys", Name: "eth1/60", OperSt: "up"}, ""},
+		{"PORT2VRF", Mapping{Oper: MappingAdd, Dn: "sys/intf/phys-[eth1/60]/rtvrfMbr", PortName: "eth1/60", VrfName: "red"}, ""},
+		{"PORT2VRF", Mapping{Oper: MappingDelete, Dn: "sys/intf/phys-[eth1/60]/rtvrfMbr"}, ""},
+		{"VLAN", Mapping{Oper: MappingAdd, Dn: "sys/vlan-5", Name: "vlan5"}, "unknown mapping component"},
+		{"", Mapping{Oper: MappingAdd, Dn: "sys/inst-blue", Name: "blue", ID: "41"}, "unknown mapping component"},
+		{"VRF", Mapping{Oper: "replace", Dn: "sys/inst-red"}, "unknown mapping oper"},
+		{"VRF", Mapping{Oper: MappingAdd, Name: "blue", ID: "41"}, "has no dn"},
+		{"VRF", Mapping{Oper: MappingAdd, Dn: "sys/inst-blue", ID: "41"}, "has no name"},
+		{"VRF", Mapping{Oper: MappingAdd, Dn: "sys/inst-blue", Name: "blue"}, "is not a number"},
+		{"VRF", Mapping{Oper: MappingAdd, Dn: "sys/inst-blue", Name: "blue", ID: "x"}, "is not a number"},
+		{"PORT", Mapping{Oper: MappingAdd, Dn: "sys/intf/phys-[eth1/61]/phys", Name: "eth1/61"}, "has no operSt"},
+		{"PORT2VRF", Mapping{Oper: MappingAdd, Dn: "sys/intf/phys-[eth1/61]/rtvrfMbr", VrfName: "red"}, "has no portName"},
+		{"PORT2VRF", Mapping{Oper: MappingAdd, Dn: "sys/intf/phys-[eth1/61]/rtvrfMbr", PortName: "eth1/61"}, "has no vrfName"},
+		{"PORT", Mapping{Oper: MappingDelete, Dn: "sys/intf/phys-[eth1/99]/phys"}, "no PORT mapping with dn"},
+	}
+	for _, test := range tests {
+		before := s.Status().Inventory
+		message, err := s.ChangeMapping(test.component, test.mapping)
+		if test.err == "" {
+			if err != nil || message == nil {
+				t.Errorf("ChangeMapping(%s, %+v) error = %v", test.component, test.mapping, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ChangeMapping(%s, %+v) error = %v, want %q", test.component, test.mapping, err, test.err)
+		}
+		if after := s.Status().Inventory; len(after) != len(before) || after[test.component] != before[test.component] {
+			t.Errorf("ChangeMapping(%s, %+v) changed the inventory from %v to %v", test.component, test.mapping, before, after)
+		}
+	}
+}
+
+func TestLoadInventoryKeepsUnknownMappings(t *testing.T) {
+	profile := DefaultProfile
+	profile.AddMappings = append(append([]json.RawMessage(nil), profile.AddMappings...),
+		json.RawMessage(`{"cmd":"switch/add_mapping","switchId":"{{serial}}","data":{"component":"VLAN","mappings":[{"oper":"add","dn":"sys/vlan-5"}]}}`),
+		json.RawMessage(`{"cmd":"switch/add_mapping","switchId":"{{serial}}","data":{"component":"VRF","mappings":[{"oper":"add","dn":"sys/inst-x","name":"x","id":"unknown"}]}}`))
+	s, err := NewSwitch(WithGateway("gw"), WithProfile(&profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Status().Inventory["VLAN"]; n != 1 {
+		t.Errorf("%d VLAN mappings loaded, want 1", n)
+	}
+	if n := len(s.AddMappingMessages()); n != len(profile.AddMappings) {
+		t.Errorf("%d add_mapping messages, want %d", n, len(profile.AddMappings))
+	}
+}
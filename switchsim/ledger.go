@@ -0,0 +1,192 @@
+package switchsim
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LedgerEntry is one flow a switch exported, or one flow a collector
+// received.
+type LedgerEntry struct {
+	Time      time.Time `json:"time"` // when the datagram was sent or received
+	Serial    string    `json:"serial"`
+	Sensor    int       `json:"sensor"`
+	Collector string    `json:"collector"`
+	Addr      string    `json:"addr"`     // host:port of the collector
+	Sequence  uint32    `json:"sequence"` // of the datagram
+	FlowID    uint64    `json:"flowId"`   // per switch
+	Flow      Flow      `json:"flow"`
+}
+
+// Ledger writes the flows switches export as JSON lines, the ground truth
+// VerifyLedger checks collectors against.
+type Ledger struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	err    error
+}
+
+func NewLedger(fileName string) (*Ledger, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &Ledger{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (l *Ledger) record(entries []LedgerEntry) {
+	if l == nil || len(entries) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	encoder := json.NewEncoder(l.writer)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil && l.err == nil {
+			l.err = err
+		}
+	}
+}
+
+// Close flushes the ledger, it returns the first error writing it.
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// ReadLedger reads a ledger, or the flows a collector received in the same
+// format.
+func ReadLedger(fileName string) ([]LedgerEntry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []LedgerEntry
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var e LedgerEntry
+		if err := decoder.Decode(&e); err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %v", fileName, len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// maxVerifyProblems is how many discrepancies a verification lists.
+const maxVerifyProblems = 100
+
+// VerifyCounts tallies how the flows of a switch or collector arrived.
+type VerifyCounts struct {
+	Sent       int `json:"sent"`
+	Received   int `json:"received"`
+	Missing    int `json:"missing"`    // sent, never received
+	Duplicated int `json:"duplicated"` // extra copies received
+	Miscounted int `json:"miscounted"` // received with other packet or byte counts
+	Misrouted  int `json:"misrouted"`  // received by another collector than it was sent to
+	Unexpected int `json:"unexpected"` // received, never sent
+}
+
+func (c VerifyCounts) ok() bool {
+	return c.Missing+c.Duplicated+c.Miscounted+c.Misrouted+c.Unexpected == 0
+}
+
+// Verification compares a ledger with what the collectors received.
+type Verification struct {
+	Total      VerifyCounts             `json:"total"`
+	Switches   map[string]*VerifyCounts `json:"switches"`
+	Collectors map[string]*VerifyCounts `json:"collectors"` // by the collector flows were sent to
+	Problems   []string                 `json:"problems"`   // the first discrepancies
+}
+
+// OK reports whether every flow was received once, as sent.
+func (v Verification) OK() bool {
+	return v.Total.ok()
+}
+
+type ledgerKey struct {
+	serial string
+	flowID uint64
+}
+
+// VerifyLedger matches the received flows to the sent ones by serial and
+// flow ID.
+func VerifyLedger(sent []LedgerEntry, received []LedgerEntry) Verification {
+	v := Verification{Switches: make(map[string]*VerifyCounts), Collectors: make(map[string]*VerifyCounts)}
+	tally := func(serial string, collector string, update func(c *VerifyCounts)) {
+		if v.Switches[serial] == nil {
+			v.Switches[serial] = &VerifyCounts{}
+		}
+		if v.Collectors[collector] == nil {
+			v.Collectors[collector] = &VerifyCounts{}
+		}
+		update(&v.Total)
+		update(v.Switches[serial])
+		update(v.Collectors[collector])
+	}
+	problem := func(format string, args ...interface{}) {
+		if len(v.Problems) < maxVerifyProblems {
+			v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	byKey := make(map[ledgerKey]LedgerEntry, len(sent))
+	for _, e := range sent {
+		byKey[ledgerKey{e.Serial, e.FlowID}] = e
+		tally(e.Serial, e.Collector, func(c *VerifyCounts) { c.Sent++ })
+	}
+	seen := make(map[ledgerKey]int, len(received))
+	for _, r := range received {
+		key := ledgerKey{r.Serial, r.FlowID}
+		e, ok := byKey[key]
+		if !ok {
+			tally(r.Serial, r.Collector, func(c *VerifyCounts) { c.Received++; c.Unexpected++ })
+			problem("%s flow %d: received by %s, never sent", r.Serial, r.FlowID, r.Collector)
+			continue
+		}
+		seen[key]++
+		tally(e.Serial, e.Collector, func(c *VerifyCounts) { c.Received++ })
+		if seen[key] > 1 {
+			tally(e.Serial, e.Collector, func(c *VerifyCounts) { c.Duplicated++ })
+			problem("%s flow %d: received %d times", e.Serial, e.FlowID, seen[key])
+			continue
+		}
+		if r.Collector != e.Collector {
+			tally(e.Serial, e.Collector, func(c *VerifyCounts) { c.Misrouted++ })
+			problem("%s flow %d: sent to %s, received by %s", e.Serial, e.FlowID, e.Collector, r.Collector)
+		}
+		if r.Flow.Packets != e.Flow.Packets || r.Flow.Bytes != e.Flow.Bytes {
+			tally(e.Serial, e.Collector, func(c *VerifyCounts) { c.Miscounted++ })
+			problem("%s flow %d: sent %d packets %d bytes, received %d packets %d bytes",
+				e.Serial, e.FlowID, e.Flow.Packets, e.Flow.Bytes, r.Flow.Packets, r.Flow.Bytes)
+		}
+	}
+	var missing []LedgerEntry
+	for key, e := range byKey {
+		if seen[key] == 0 {
+			missing = append(missing, e)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Serial < missing[j].Serial || missing[i].Serial == missing[j].Serial && missing[i].FlowID < missing[j].FlowID
+	})
+	for _, e := range missing {
+		tally(e.Serial, e.Collector, func(c *VerifyCounts) { c.Missing++ })
+		problem("%s flow %d: sent to %s, never received", e.Serial, e.FlowID, e.Collector)
+	}
+	return v
+}
@@ -0,0 +1,61 @@
+package switchsim
+
+import "runtime"
+
+// MemoryUsage is what a fleet costs the simulator's host, to size hosts for
+// large fleets.
+type MemoryUsage struct {
+	Switches       int            `json:"switches"`
+	Connected      int            `json:"connected"`
+	Goroutines     int            `json:"goroutines"`
+	HeapBytes      uint64         `json:"heapBytes"`      // heap in use
+	StackBytes     uint64         `json:"stackBytes"`     // goroutine stacks
+	SysBytes       uint64         `json:"sysBytes"`       // obtained from the OS
+	BufferBytes    int            `json:"bufferBytes"`    // websocket buffers of the connected switches
+	BytesPerSwitch uint64         `json:"bytesPerSwitch"` // heap and stacks over the switches
+	PerSwitch      []SwitchMemory `json:"perSwitch"`
+}
+
+// SwitchMemory is what one switch holds beyond the fleet's share.
+type SwitchMemory struct {
+	Serial      string `json:"serial"`
+	Connected   bool   `json:"connected"`
+	Compressed  bool   `json:"compressed,omitempty"` // permessage-deflate adds its compressor state
+	BufferBytes int    `json:"bufferBytes"`
+}
+
+// heldBufferBytes is the websocket buffer the switch holds now, none while it
+// is disconnected. The caller holds s.mu.
+func (s *Switch) heldBufferBytes() int {
+	if s.connection == nil {
+		return 0
+	}
+	return s.bufferBytes
+}
+
+// Memory measures the fleet's memory. It stops the world for a moment, don't
+// call it too often.
+func (f *Fleet) Memory() MemoryUsage {
+	var usage MemoryUsage
+	for _, s := range f.List() {
+		usage.Switches++
+		s.mu.Lock()
+		m := SwitchMemory{Serial: s.switchName, Connected: s.connection != nil, Compressed: s.connection != nil && s.compressed, BufferBytes: s.heldBufferBytes()}
+		s.mu.Unlock()
+		if m.Connected {
+			usage.Connected++
+		}
+		usage.BufferBytes += m.BufferBytes
+		usage.PerSwitch = append(usage.PerSwitch, m)
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	usage.Goroutines = runtime.NumGoroutine()
+	usage.HeapBytes = m.HeapInuse
+	usage.StackBytes = m.StackInuse
+	usage.SysBytes = m.Sys
+	if usage.Switches > 0 {
+		usage.BytesPerSwitch = (usage.HeapBytes + usage.StackBytes) / uint64(usage.Switches)
+	}
+	return usage
+}
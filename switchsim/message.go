@@ -1,4 +1,4 @@
-package main
+package switchsim
 
 type SwitchRegistration struct {
 	Serial string `json:"serial"`
@@ -31,11 +31,11 @@ type SwitchCheckInMessage struct {
 	Data     struct {
 		AgentVersion string `json:"agentVersion"`
 		Capability   string `json:"capability"`
-		GatewayUUID  string `json:"gateway_uuid"`
+		GatewayUUID  string `json:"gateway_uuid,omitempty"`
 		ImageName    string `json:"imageName"`
-		IP           string `json:"ip"`
+		IP           string `json:"ip,omitempty"`
 		ModTs        string `json:"modTs"`
-		Role         string `json:"role"`
+		Role         string `json:"role,omitempty"`
 		State        string `json:"state"`
 		Status       string `json:"status"`
 		SwitchName   string `json:"switch_name"`
@@ -43,6 +43,25 @@ type SwitchCheckInMessage struct {
 	} `json:"data"`
 }
 
+type Mapping struct {
+	Oper     string `json:"oper"`
+	Dn       string `json:"dn"`
+	Name     string `json:"name,omitempty"`
+	ID       string `json:"id,omitempty"`
+	OperSt   string `json:"operSt,omitempty"`
+	PortName string `json:"portName,omitempty"`
+	VrfName  string `json:"vrfName,omitempty"`
+}
+
+type SwitchAddMappingMessage struct {
+	Cmd      string `json:"cmd"`
+	SwitchID string `json:"switchId"`
+	Data     struct {
+		Component string    `json:"component"` // VRF, PORT or PORT2VRF
+		Mappings  []Mapping `json:"mappings"`
+	} `json:"data"`
+}
+
 type CollectorBucket struct {
 	Lo        int    `json:"lo"`
 	Hi        int    `json:"hi"`
@@ -0,0 +1,189 @@
+package switchsim
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// config collects the options a switch is created with.
+type config struct {
+	gateways       *GatewayPool
+	tlsConfig      *tls.Config
+	transport      Transport
+	sourceIP       string
+	sourceIPs      *SourceIPPool
+	identity       *SwitchIdentity
+	profile        *SwitchProfile
+	clock          *VirtualClock
+	placement      Placement
+	upTime         time.Duration
+	recordDir      string
+	faults         *FaultConfig
+	closePolicy    ClosePolicy
+	reconnectDelay time.Duration
+	validation     string
+	framing        string
+	strictFraming  bool
+	trafficMix     TrafficMix
+	trafficSeed    int64
+	flowsPerSecond int
+	ledger         *Ledger
+	exportShape    *ExportShape
+	onMessage      []func(s *Switch, direction string, message []byte)
+	onStateChange  []func(s *Switch, old string, new string)
+	onConfig       []func(s *Switch, config *ServerConfigMessage)
+}
+
+// Option configures a Switch created with NewSwitch, or every switch of a
+// Fleet.
+type Option func(*config)
+
+func newConfig(options []Option) *config {
+	c := &config{
+		tlsConfig:      &tls.Config{InsecureSkipVerify: true},
+		transport:      DefaultTransport,
+		profile:        &DefaultProfile,
+		reconnectDelay: time.Second,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.clock == nil {
+		c.clock = NewVirtualClock(1)
+	}
+	return c
+}
+
+// WithGateway sets the host[:port] of the gateway the switch registers with.
+func WithGateway(host string) Option {
+	return func(c *config) {
+		c.gateways = &GatewayPool{Gateways: []Gateway{{Register: host, Websocket: host}}, Assignment: AssignRoundRobin}
+	}
+}
+
+// WithGatewayPool makes the switch register with a gateway of the pool and
+// fail over to the others.
+func WithGatewayPool(pool *GatewayPool) Option {
+	return func(c *config) { c.gateways = pool }
+}
+
+// WithTLSConfig sets the TLS config of the https registration and the
+// websocket, by default the gateway's certificate isn't verified.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) { c.tlsConfig = tlsConfig }
+}
+
+// WithTransport sets the proxy and timeouts of the connections to the
+// gateway, DefaultTransport by default.
+func WithTransport(transport Transport) Option {
+	return func(c *config) { c.transport = transport }
+}
+
+// WithSourceIP makes the switch connect to the gateway from ip, which has to
+// be an address of the host.
+func WithSourceIP(ip string) Option {
+	return func(c *config) { c.sourceIP = ip }
+}
+
+// WithSourceIPPool makes the switch connect from an address of the pool no
+// other switch uses, unless WithSourceIP is given. Give every switch of a
+// fleet the same pool, the address goes back to it when the switch is
+// removed.
+func WithSourceIPPool(pool *SourceIPPool) Option {
+	return func(c *config) { c.sourceIPs = pool }
+}
+
+// WithFraming sends the switch's messages in framing frames, FramingBinary or
+// FramingText, instead of the profile's. With strict, a gateway message in
+// other frames or not UTF-8 closes the websocket, otherwise it is counted.
+func WithFraming(framing string, strict bool) Option {
+	return func(c *config) {
+		c.framing = framing
+		c.strictFraming = strict
+	}
+}
+
+// WithIdentity sets the switch's serial, switch_name, management IP and MAC,
+// by default it is the captured switch of the profile.
+func WithIdentity(identity SwitchIdentity) Option {
+	return func(c *config) { c.identity = &identity }
+}
+
+// WithProfile sets the switch model, DefaultProfile by default.
+func WithProfile(profile *SwitchProfile) Option {
+	return func(c *config) { c.profile = profile }
+}
+
+// WithClock sets the clock systemUpTime and modTs are taken from, by default a
+// clock running at wall clock speed.
+func WithClock(clock *VirtualClock) Option {
+	return func(c *config) { c.clock = clock }
+}
+
+// WithPlacement puts the switch at a place in the fabric topology.
+func WithPlacement(placement Placement) Option {
+	return func(c *config) { c.placement = placement }
+}
+
+// WithUpTime sets the systemUpTime the switch starts with, by default the
+// profile's.
+func WithUpTime(upTime time.Duration) Option {
+	return func(c *config) { c.upTime = upTime }
+}
+
+// WithRecording records the switch's websocket session to
+// <dir>/<serial>.session.
+func WithRecording(dir string) Option {
+	return func(c *config) { c.recordDir = dir }
+}
+
+// WithFaults injects faults into the switch's messages and registrations.
+func WithFaults(faults *FaultConfig) Option {
+	return func(c *config) { c.faults = faults }
+}
+
+// WithClosePolicy sets what the switch does when the gateway closes its
+// websocket and how long it waits before doing it.
+func WithClosePolicy(policy ClosePolicy, reconnectDelay time.Duration) Option {
+	return func(c *config) { c.closePolicy, c.reconnectDelay = policy, reconnectDelay }
+}
+
+// WithValidation checks every gateway message against its schema, mode is
+// ValidateReport or ValidateStrict.
+func WithValidation(mode string) Option {
+	return func(c *config) { c.validation = mode }
+}
+
+// WithTraffic sets the traffic mix and seed of the switch's flow generators,
+// by default web traffic with seed 0.
+func WithTraffic(mix TrafficMix, seed int64) Option {
+	return func(c *config) { c.trafficMix, c.trafficSeed = mix, seed }
+}
+
+// WithExport exports flowsPerSecond flows a second over UDP to the collectors
+// of the gateway's config_msg, and writes them to ledger unless it is nil.
+func WithExport(flowsPerSecond int, ledger *Ledger) Option {
+	return func(c *config) { c.flowsPerSecond, c.ledger = flowsPerSecond, ledger }
+}
+
+// WithExportShape ramps, bursts and limits the export. Give every switch of a
+// fleet the same shape, its ramp, spike and limits are shared.
+func WithExportShape(shape *ExportShape) Option {
+	return func(c *config) { c.exportShape = shape }
+}
+
+// OnMessage calls fn with every message the switch sends ("sent") or receives
+// ("recv").
+func OnMessage(fn func(s *Switch, direction string, message []byte)) Option {
+	return func(c *config) { c.onMessage = append(c.onMessage, fn) }
+}
+
+// OnStateChange calls fn every time the switch changes state.
+func OnStateChange(fn func(s *Switch, old string, new string)) Option {
+	return func(c *config) { c.onStateChange = append(c.onStateChange, fn) }
+}
+
+// OnConfig calls fn with every collector configuration the gateway sends.
+func OnConfig(fn func(s *Switch, config *ServerConfigMessage)) Option {
+	return func(c *config) { c.onConfig = append(c.onConfig, fn) }
+}
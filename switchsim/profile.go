@@ -0,0 +1,45 @@
+package switchsim
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+// Placeholders in profile messages for the serial and switch_name of the
+// simulated switch.
+const (
+	ProfileSerial     = "{{serial}}"
+	ProfileSwitchName = "{{switchName}}"
+)
+
+// SwitchProfile holds the messages a switch model sends after the websocket is
+// up, in the order it sends them. Messages carry the {{serial}} and
+// {{switchName}} placeholders; logParser -import writes these from real
+// switch captures.
+type SwitchProfile struct {
+	Name        string            `json:"name"`
+	Serial      string            `json:"serial"`     // serial of the captured switch
+	SwitchName  string            `json:"switchName"` // switch_name of the captured switch
+	CheckIn     json.RawMessage   `json:"checkIn"`
+	Config      json.RawMessage   `json:"config"`
+	AddMappings []json.RawMessage `json:"addMappings"`
+	Framing     string            `json:"framing,omitempty"` // frame type of the switch's messages, FramingBinary if empty
+}
+
+func LoadProfile(fileName string) (*SwitchProfile, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var profile SwitchProfile
+	if err = json.Unmarshal(data, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (p *SwitchProfile) render(message json.RawMessage, serial string, switchName string) []byte {
+	r := strings.NewReplacer(ProfileSerial, serial, ProfileSwitchName, switchName)
+	return []byte(r.Replace(string(message)))
+}
@@ -0,0 +1,198 @@
+package switchsim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+// How strictly gateway messages are checked against their schema.
+const (
+	ValidateOff    = ""       // only the cmd is decoded
+	ValidateReport = "report" // violations are logged and counted
+	ValidateStrict = "strict" // violations also close the websocket
+)
+
+// schema describes the JSON a gateway message must have. Objects reject
+// fields they don't list.
+type schema struct {
+	kind   string // object, array, string, integer, number or boolean
+	fields []schemaField
+	items  *schema
+}
+
+type schemaField struct {
+	name     string
+	required bool
+	schema   *schema
+}
+
+var (
+	schemaString  = &schema{kind: "string"}
+	schemaInteger = &schema{kind: "integer"}
+	schemaBoolean = &schema{kind: "boolean"}
+)
+
+func object(fields ...schemaField) *schema { return &schema{kind: "object", fields: fields} }
+func arrayOf(items *schema) *schema        { return &schema{kind: "array", items: items} }
+func field(name string, s *schema) schemaField {
+	return schemaField{name: name, required: true, schema: s}
+}
+
+var schemaCollector = object(
+	field("decommissioned", schemaBoolean),
+	field("ip", schemaString),
+	field("name", schemaString),
+	field("updated_at", schemaInteger),
+	field("collector_id", schemaInteger),
+	field("healthy", schemaBoolean),
+	field("spine_udp_port", schemaInteger),
+	field("udp_port", schemaInteger),
+)
+
+// Schemas of the gateway's answers, per cmd.
+var serverSchemas = map[string]*schema{
+	"switch/check_in": object(
+		field("responseCode", schemaInteger),
+		field("cmd", schemaString),
+	),
+	"switch/config_msg": object(
+		field("responseCode", schemaInteger),
+		field("cmd", schemaString),
+		field("data", object(
+			field("buckets", arrayOf(object(
+				field("lo", schemaInteger),
+				field("hi", schemaInteger),
+				field("primary", schemaString),
+				field("secondary", schemaString),
+			))),
+			field("active", arrayOf(schemaCollector)),
+			field("deactivated", arrayOf(schemaCollector)),
+			field("dataPathDisable", schemaBoolean),
+			field("cfgOpts", object(
+				field("exportIntervalMs", schemaInteger),
+			)),
+			field("hwSensors", arrayOf(object(
+				field("dn", schemaString),
+				field("exporter_id", schemaInteger),
+				field("src_port", schemaInteger),
+				field("state", schemaString),
+			))),
+		)),
+	),
+	"switch/add_mapping": object(
+		field("responseCode", schemaInteger),
+		field("cmd", schemaString),
+	),
+}
+
+func jsonKind(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// check appends the ways v doesn't match the schema to violations.
+func (s *schema) check(path string, v interface{}, violations []string) []string {
+	kind := jsonKind(v)
+	if kind != s.kind && !(s.kind == "number" && kind == "integer") {
+		return append(violations, fmt.Sprintf("%s: expected %s, got %s", path, s.kind, kind))
+	}
+	switch s.kind {
+	case "object":
+		o := v.(map[string]interface{})
+		known := make(map[string]bool, len(s.fields))
+		for _, f := range s.fields {
+			known[f.name] = true
+			value, ok := o[f.name]
+			if !ok {
+				if f.required {
+					violations = append(violations, fmt.Sprintf("%s: missing field %s", path, f.name))
+				}
+				continue
+			}
+			violations = f.schema.check(path+"."+f.name, value, violations)
+		}
+		var unknown []string
+		for name := range o {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			violations = append(violations, fmt.Sprintf("%s: unknown field %s", path, name))
+		}
+	case "array":
+		for i, item := range v.([]interface{}) {
+			violations = s.items.check(fmt.Sprintf("%s[%d]", path, i), item, violations)
+		}
+	}
+	return violations
+}
+
+// maxViolations is how many schema violations a switch keeps for the report.
+const maxViolations = 20
+
+// validate checks a gateway message and records its violations, it returns
+// false if there are any.
+func (s *Switch) validate(message []byte) bool {
+	violations := validateServerMessage(message)
+	if len(violations) == 0 {
+		return true
+	}
+	s.mu.Lock()
+	s.stats.SchemaViolations += len(violations)
+	for _, v := range violations {
+		glog.Errorf(s.switchName + ": schema violation: " + v + "\n")
+		if len(s.stats.Violations) < maxViolations {
+			s.stats.Violations = append(s.stats.Violations, v)
+		}
+	}
+	s.mu.Unlock()
+	return false
+}
+
+// validateServerMessage checks a gateway message against the schema of its
+// cmd. The bucket invariants of a config_msg are checked by checkConfig.
+func validateServerMessage(message []byte) []string {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return []string{"not JSON: " + err.Error()}
+	}
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return []string{"message: expected object, got " + jsonKind(v)}
+	}
+	cmd, _ := o["cmd"].(string)
+	s, ok := serverSchemas[cmd]
+	if !ok {
+		return []string{fmt.Sprintf("message: unknown cmd %q", cmd)}
+	}
+	violations := s.check(cmd, v, nil)
+	if code, ok := o["responseCode"].(json.Number); ok && string(code) != "200" {
+		violations = append(violations, fmt.Sprintf("%s.responseCode: %s", cmd, code))
+	}
+	return violations
+}
@@ -0,0 +1,84 @@
+package switchsim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sessionRecorder writes every websocket message of one switch to
+// <dir>/<switchName>.session as "<time> sent|recv <json>" lines, which
+// logParser reads the same way as a switch agent log.
+type sessionRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newSessionRecorder(dir string, switchName string) (*sessionRecorder, error) {
+	file, err := os.OpenFile(filepath.Join(dir, switchName+".session"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionRecorder{file: file}, nil
+}
+
+func (r *sessionRecorder) record(direction string, message []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.file, "%s %s %s\n", time.Now().Format(time.RFC3339Nano), direction, message)
+}
+
+// observe records a message the switch sent or received and hands it to the
+// watchers.
+func (s *Switch) observe(direction string, message []byte) {
+	s.recorder.record(direction, message)
+	s.mu.Lock()
+	if direction == "sent" {
+		s.stats.Sent++
+	} else {
+		s.stats.Received++
+	}
+	watchers := make([]func(string, []byte), 0, len(s.watchers))
+	for _, w := range s.watchers {
+		watchers = append(watchers, w)
+	}
+	s.mu.Unlock()
+	for _, fn := range s.onMessage {
+		fn(s, direction, message)
+	}
+	for _, w := range watchers {
+		w(direction, message)
+	}
+}
+
+// Watch calls fn with every message the switch sends or receives until the
+// returned function is called.
+func (s *Switch) Watch(fn func(direction string, message []byte)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[int]func(string, []byte))
+	}
+	id := s.nextWatcher
+	s.nextWatcher++
+	s.watchers[id] = fn
+	return func() {
+		s.mu.Lock()
+		delete(s.watchers, id)
+		s.mu.Unlock()
+	}
+}
+
+func (r *sessionRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file.Close()
+}
@@ -0,0 +1,148 @@
+package switchsim
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Burst modes of an export shape.
+const (
+	BurstNone  = ""
+	BurstMicro = "micro" // every BurstEvery, BurstFactor times the flows of BurstLength at once
+	BurstSpike = "spike" // BurstFactor times the rate for BurstLength, BurstEvery after the export starts
+)
+
+// ExportShape shapes the export of a whole fleet: the switches share one
+// ramp, one spike and one rate limit. The zero value changes nothing.
+type ExportShape struct {
+	Burst       string
+	BurstEvery  time.Duration
+	BurstLength time.Duration
+	BurstFactor float64
+	Ramp        time.Duration // from nothing to the full rate, from the first export
+	// Limits of all switches' export datagrams together, 0 for none. Mbps
+	// counts the UDP payload.
+	PacketsPerSecond float64
+	Mbps             float64
+
+	startOnce sync.Once
+	start     time.Time
+	mu        sync.Mutex
+	packets   time.Time // when the packet limit has caught up with what was sent
+	bits      time.Time // the same for the bit rate limit
+}
+
+// Validate checks the burst settings.
+func (sh *ExportShape) Validate() error {
+	switch sh.Burst {
+	case BurstNone:
+		return nil
+	case BurstMicro, BurstSpike:
+	default:
+		return fmt.Errorf("unknown burst mode %q", sh.Burst)
+	}
+	if sh.BurstEvery <= 0 || sh.BurstLength <= 0 || sh.BurstFactor <= 0 {
+		return fmt.Errorf("burst mode %s needs a positive interval, length and factor", sh.Burst)
+	}
+	return nil
+}
+
+// started returns when the fleet started exporting.
+func (sh *ExportShape) started(now time.Time) time.Time {
+	sh.startOnce.Do(func() { sh.start = now })
+	return sh.start
+}
+
+// factor is how much of the configured rate switches export elapsed after the
+// export started, before it the rate is as at the start.
+func (sh *ExportShape) factor(elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	factor := 1.0
+	if sh.Ramp > 0 && elapsed < sh.Ramp {
+		factor = float64(elapsed) / float64(sh.Ramp)
+	}
+	if sh.Burst == BurstSpike && elapsed >= sh.BurstEvery && elapsed < sh.BurstEvery+sh.BurstLength {
+		factor *= sh.BurstFactor
+	}
+	return factor
+}
+
+// flows is how many flows a switch exporting flowsPerSecond owes for the time
+// from from to to. The factor is integrated over that time, so a spike shorter
+// than the export interval counts for just its length.
+func (sh *ExportShape) flows(flowsPerSecond float64, from time.Time, to time.Time) float64 {
+	if !to.After(from) {
+		return 0
+	}
+	if sh == nil {
+		return flowsPerSecond * to.Sub(from).Seconds()
+	}
+	start := sh.started(to)
+	// The factor is linear between these, the midpoint of a piece is its mean.
+	edges := []time.Duration{from.Sub(start), to.Sub(start), 0, sh.Ramp}
+	if sh.Burst == BurstSpike {
+		edges = append(edges, sh.BurstEvery, sh.BurstEvery+sh.BurstLength)
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i] < edges[j] })
+	seconds := 0.0
+	for i := 1; i < len(edges); i++ {
+		a, b := edges[i-1], edges[i]
+		if a < from.Sub(start) || b > to.Sub(start) || b == a {
+			continue
+		}
+		seconds += sh.factor(a+(b-a)/2) * (b - a).Seconds()
+	}
+	return flowsPerSecond * seconds
+}
+
+// nextMicroburst returns when the next microburst after now is due, or the
+// zero time if there are none.
+func (sh *ExportShape) nextMicroburst(now time.Time) time.Time {
+	if sh == nil || sh.Burst != BurstMicro {
+		return time.Time{}
+	}
+	start := sh.started(now)
+	bursts := now.Sub(start) / sh.BurstEvery
+	return start.Add((bursts + 1) * sh.BurstEvery)
+}
+
+// microburstFlows is how many flows a switch exporting flowsPerSecond sends in
+// a microburst.
+func (sh *ExportShape) microburstFlows(flowsPerSecond int) int {
+	return int(float64(flowsPerSecond) * sh.BurstLength.Seconds() * sh.BurstFactor)
+}
+
+// maxLimitBurst is how far ahead of the rate limits a burst of datagrams may
+// get before it has to wait.
+const maxLimitBurst = 100 * time.Millisecond
+
+// reserve accounts for a datagram of size bytes and returns how long to wait
+// before sending it to stay within the limits.
+func (sh *ExportShape) reserve(size int) time.Duration {
+	if sh == nil || (sh.PacketsPerSecond <= 0 && sh.Mbps <= 0) {
+		return 0
+	}
+	now := time.Now()
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	wait := time.Duration(0)
+	take := func(at *time.Time, amount float64, rate float64) {
+		if rate <= 0 {
+			return
+		}
+		if at.Before(now.Add(-maxLimitBurst)) {
+			*at = now.Add(-maxLimitBurst)
+		}
+		*at = at.Add(time.Duration(amount / rate * float64(time.Second)))
+		if d := at.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	take(&sh.packets, 1, sh.PacketsPerSecond)
+	take(&sh.bits, float64(size*8), sh.Mbps*1e6)
+	return wait
+}
@@ -0,0 +1,67 @@
+package switchsim
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// exported adds up the flows an exporter ticking every interval owes from
+// start to end.
+func exported(sh *ExportShape, flowsPerSecond float64, start time.Time, end time.Time, interval time.Duration) float64 {
+	total := 0.0
+	for last, now := start, start.Add(interval); !now.After(end); last, now = now, now.Add(interval) {
+		total += sh.flows(flowsPerSecond, last, now)
+	}
+	return total
+}
+
+func TestExportShapeFlows(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	spike := func() *ExportShape {
+		return &ExportShape{Burst: BurstSpike, BurstEvery: 10 * time.Second, BurstLength: 100 * time.Millisecond, BurstFactor: 10}
+	}
+	tests := []struct {
+		name     string
+		shape    *ExportShape
+		from     time.Duration // after the export started
+		to       time.Duration
+		interval time.Duration
+		want     float64
+	}{
+		{"no shape", nil, 0, 20 * time.Second, time.Second, 2000},
+		{"spike over one burst period, 1s ticks", spike(), 0, 20 * time.Second, time.Second, 2000 + 100*0.1*9},
+		{"spike over one burst period, 3s ticks", spike(), 0, 21 * time.Second, 3 * time.Second, 2100 + 100*0.1*9},
+		{"spike over one burst period, 30ms ticks", spike(), 0, 20010 * time.Millisecond, 30 * time.Millisecond, 2001 + 100*0.1*9},
+		{"tick ending in the spike", spike(), 9 * time.Second, 10050 * time.Millisecond, 1050 * time.Millisecond, 100*1.0 + 100*0.05*10},
+		{"before the spike", spike(), 0, 9 * time.Second, time.Second, 900},
+		{"ramp", &ExportShape{Ramp: 10 * time.Second}, 0, 20 * time.Second, time.Second, 500 + 1000},
+		{"ramp into a spike", &ExportShape{Ramp: 20 * time.Second, Burst: BurstSpike, BurstEvery: 10 * time.Second, BurstLength: time.Second, BurstFactor: 3}, 0, 20 * time.Second, 4 * time.Second, 1000 + 100*2*0.525},
+	}
+	for _, test := range tests {
+		if test.shape != nil {
+			test.shape.started(start)
+		}
+		got := exported(test.shape, 100, start.Add(test.from), start.Add(test.to), test.interval)
+		if math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%s: %.3f flows, want %.3f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExportShapeBeforeStart(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	sh := &ExportShape{Ramp: 10 * time.Second}
+	sh.started(start)
+	if got := sh.flows(100, start.Add(-time.Second), start); got != 0 {
+		t.Errorf("ramp owes %.3f flows before the export started, want 0", got)
+	}
+	sh = &ExportShape{}
+	sh.started(start)
+	if got := sh.flows(100, start.Add(-time.Second), start); math.Abs(got-100) > 1e-6 {
+		t.Errorf("owes %.3f flows for the second before the export started, want 100", got)
+	}
+	if got := sh.flows(100, start, start); got != 0 {
+		t.Errorf("owes %.3f flows for no time, want 0", got)
+	}
+}
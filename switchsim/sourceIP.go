@@ -0,0 +1,176 @@
+package switchsim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// maxSourceIPs bounds a source IP pool, a whole loopback /8 won't fit.
+const maxSourceIPs = 1 << 20
+
+// SourceIPPool hands every switch its own local address to connect from, so
+// the gateway and firewalls see the switches apart. The addresses have to be
+// configured on the host, e.g. as secondary addresses of a dummy interface,
+// or in the network namespace the simulator runs in.
+type SourceIPPool struct {
+	mu    sync.Mutex
+	ips   []string
+	inUse map[string]bool
+}
+
+// ParseSourceIPPool parses addresses, CIDRs (every host address), ranges
+// first-last and iface:<name> (the interface's addresses) separated by commas,
+// e.g. 10.1.0.10-10.1.0.99,iface:dummy0. It fails if an address isn't one of
+// the host's.
+func ParseSourceIPPool(s string) (*SourceIPPool, error) {
+	local, err := localIPs()
+	if err != nil {
+		return nil, err
+	}
+	pool := &SourceIPPool{inUse: make(map[string]bool)}
+	seen := make(map[string]bool)
+	add := func(ip net.IP) error {
+		if !local[ip.String()] && !ip.IsLoopback() {
+			return fmt.Errorf("%s is not an address of this host", ip)
+		}
+		if len(pool.ips) >= maxSourceIPs {
+			return fmt.Errorf("more than %d source addresses", maxSourceIPs)
+		}
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			pool.ips = append(pool.ips, ip.String())
+		}
+		return nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(entry, "iface:"):
+			iface, err := net.InterfaceByName(strings.TrimPrefix(entry, "iface:"))
+			if err != nil {
+				return nil, err
+			}
+			addrs, err := iface.Addrs()
+			if err != nil {
+				return nil, err
+			}
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+					if err := add(ipNet.IP); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case strings.Contains(entry, "/"):
+			ip, subnet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, err
+			}
+			ip = ip.Mask(subnet.Mask)
+			ones, bits := subnet.Mask.Size()
+			for ; subnet.Contains(ip); ip = incrementIP(ip) {
+				// Skip the network and broadcast addresses of IPv4 subnets.
+				if bits == 32 && ones < 31 && (ip.Equal(subnet.IP) || !subnet.Contains(incrementIP(ip))) {
+					continue
+				}
+				if err := add(ip); err != nil {
+					return nil, err
+				}
+			}
+		case strings.Contains(entry, "-"):
+			bounds := strings.SplitN(entry, "-", 2)
+			first, last := net.ParseIP(strings.TrimSpace(bounds[0])), net.ParseIP(strings.TrimSpace(bounds[1]))
+			if first == nil || last == nil || (first.To4() == nil) != (last.To4() == nil) {
+				return nil, fmt.Errorf("%q is not a range of addresses", entry)
+			}
+			if first.To4() != nil {
+				first, last = first.To4(), last.To4()
+			}
+			if bytes.Compare(first, last) > 0 {
+				return nil, fmt.Errorf("range %q ends before it starts", entry)
+			}
+			for ip := first; ; ip = incrementIP(ip) {
+				if err := add(ip); err != nil {
+					return nil, err
+				}
+				if ip.Equal(last) {
+					break
+				}
+			}
+		default:
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an address, CIDR, range or iface:<name>", entry)
+			}
+			if err := add(ip); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(pool.ips) == 0 {
+		return nil, fmt.Errorf("no source address in %q", s)
+	}
+	return pool, nil
+}
+
+func localIPs() (map[string]bool, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[string]bool)
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			local[ipNet.IP.String()] = true
+		}
+	}
+	return local, nil
+}
+
+// Len is the number of addresses in the pool.
+func (p *SourceIPPool) Len() int {
+	return len(p.ips)
+}
+
+// take returns the first address no switch uses.
+func (p *SourceIPPool) take() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ip := range p.ips {
+		if !p.inUse[ip] {
+			p.inUse[ip] = true
+			return ip, nil
+		}
+	}
+	return "", errors.New("all source addresses are in use")
+}
+
+// release returns an address to the pool.
+func (p *SourceIPPool) release(ip string) {
+	p.mu.Lock()
+	delete(p.inUse, ip)
+	p.mu.Unlock()
+}
+
+// checkInIP is the ip the check-in reports: the address the switch connects
+// from if it has one of its own from a pool, otherwise the identity's
+// management IP. A -sourceIP shared by the fleet isn't reported.
+func (s *Switch) checkInIP() string {
+	if s.sourceIPs != nil {
+		return s.sourceIP
+	}
+	return s.identity.IP
+}
+
+// releaseSourceIP returns the switch's address to the pool it was taken from.
+func (s *Switch) releaseSourceIP() {
+	if s.sourceIPs != nil {
+		s.sourceIPs.release(s.sourceIP)
+	}
+}
@@ -0,0 +1,121 @@
+package switchsim
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseSourceIPPool(t *testing.T) {
+	tests := []struct {
+		spec string
+		ips  []string
+		err  string // part of the error, empty if the spec is valid
+	}{
+		{spec: "127.0.0.2", ips: []string{"127.0.0.2"}},
+		{spec: " 127.0.0.2 , 127.0.0.3,127.0.0.2", ips: []string{"127.0.0.2", "127.0.0.3"}},
+		{spec: "127.0.0.2-127.0.0.4", ips: []string{"127.0.0.2", "127.0.0.3", "127.0.0.4"}},
+		{spec: "127.0.0.9-127.0.0.9", ips: []string{"127.0.0.9"}},
+		{spec: "127.0.1.0/30", ips: []string{"127.0.1.1", "127.0.1.2"}},
+		{spec: "127.0.1.0/31", ips: []string{"127.0.1.0", "127.0.1.1"}},
+		{spec: "127.0.1.7/32", ips: []string{"127.0.1.7"}},
+		{spec: "::1", ips: []string{"::1"}},
+		{spec: "", err: "no source address"},
+		{spec: " , ", err: "no source address"},
+		{spec: "bogus", err: "is not an address, CIDR, range"},
+		{spec: "127.0.0.300", err: "is not an address, CIDR, range"},
+		{spec: "127.0.0.2-", err: "is not a range"},
+		{spec: "127.0.0.2-::1", err: "is not a range"},
+		{spec: "127.0.0.5-127.0.0.2", err: "ends before it starts"},
+		{spec: "127.0.0.0/33", err: "invalid CIDR"},
+		{spec: "192.0.2.1", err: "is not an address of this host"},
+		{spec: "127.0.0.2,192.0.2.0/30", err: "is not an address of this host"},
+		{spec: "127.0.0.0/8", err: "more than"},
+		{spec: "iface:no-such-interface", err: "no such network interface"},
+	}
+	for _, test := range tests {
+		pool, err := ParseSourceIPPool(test.spec)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseSourceIPPool(%q) error = %v, want %q", test.spec, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSourceIPPool(%q) error = %v", test.spec, err)
+			continue
+		}
+		if strings.Join(pool.ips, ",") != strings.Join(test.ips, ",") {
+			t.Errorf("ParseSourceIPPool(%q) = %v, want %v", test.spec, pool.ips, test.ips)
+		}
+		if pool.Len() != len(test.ips) {
+			t.Errorf("ParseSourceIPPool(%q).Len() = %d, want %d", test.spec, pool.Len(), len(test.ips))
+		}
+	}
+}
+
+func TestSourceIPPoolExhaustion(t *testing.T) {
+	pool, err := ParseSourceIPPool("127.0.0.2-127.0.0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"127.0.0.2", "127.0.0.3"} {
+		if ip, err := pool.take(); err != nil || ip != want {
+			t.Fatalf("take() = %q, %v, want %q", ip, err, want)
+		}
+	}
+	if ip, err := pool.take(); err == nil {
+		t.Fatalf("take() from an exhausted pool = %q, want an error", ip)
+	}
+	pool.release("127.0.0.2")
+	if ip, err := pool.take(); err != nil || ip != "127.0.0.2" {
+		t.Fatalf("take() after release = %q, %v, want 127.0.0.2", ip, err)
+	}
+}
+
+func TestSourceIPPerSwitch(t *testing.T) {
+	pool, err := ParseSourceIPPool("127.0.0.2-127.0.0.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	var switches []*Switch
+	for i := 0; i < pool.Len(); i++ {
+		identity := SwitchIdentity{Serial: "SIM" + string(rune('A'+i)), HostName: "leaf", IP: "10.1.0.1"}
+		s, err := NewSwitch(WithGateway("gateway:443"), WithIdentity(identity), WithSourceIPPool(pool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[s.sourceIP] {
+			t.Errorf("%s got %s, which another switch has", s.Serial(), s.sourceIP)
+		}
+		seen[s.sourceIP] = true
+		var checkIn SwitchCheckInMessage
+		if err := json.Unmarshal(s.CheckInMessage(), &checkIn); err != nil {
+			t.Fatal(err)
+		}
+		if checkIn.Data.IP != s.sourceIP || s.Status().SourceIP != s.sourceIP {
+			t.Errorf("%s check-in ip %s, status source IP %s, want %s", s.Serial(), checkIn.Data.IP, s.Status().SourceIP, s.sourceIP)
+		}
+		switches = append(switches, s)
+	}
+	if _, err := NewSwitch(WithGateway("gateway:443"), WithSourceIPPool(pool)); err == nil {
+		t.Error("NewSwitch with an exhausted pool succeeded")
+	}
+	s, err := NewSwitch(WithGateway("gateway:443"), WithSourceIP("127.0.0.9"), WithSourceIPPool(pool))
+	if err != nil || s.sourceIP != "127.0.0.9" {
+		t.Fatalf("NewSwitch with WithSourceIP = %v, source IP %q, want 127.0.0.9 from WithSourceIP", err, s.sourceIP)
+	}
+	shared, err := NewSwitch(WithGateway("gateway:443"), WithSourceIP("127.0.0.9"),
+		WithIdentity(SwitchIdentity{Serial: "SIMZ", HostName: "leaf", IP: "10.1.0.9"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := shared.Status().IP; ip != "10.1.0.9" {
+		t.Errorf("switch with a shared source IP reports ip %s, want its management IP 10.1.0.9", ip)
+	}
+	switches[0].releaseSourceIP()
+	if ip, err := pool.take(); err != nil || ip != switches[0].sourceIP {
+		t.Errorf("take() after releasing %s = %q, %v", switches[0].sourceIP, ip, err)
+	}
+}
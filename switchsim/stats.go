@@ -0,0 +1,104 @@
+package switchsim
+
+// Stats are the counters of one switch.
+type Stats struct {
+	Sent                 int            `json:"sent"`
+	Received             int            `json:"received"`
+	Matched              int            `json:"matched"`    // requests answered with the right response
+	Mismatched           int            `json:"mismatched"` // requests answered with another response
+	Timeouts             int            `json:"timeouts"`
+	Unanswered           int            `json:"unanswered"` // requests in flight when the switch shut down
+	Connects             int            `json:"connects"`
+	GatewayFailovers     int            `json:"gatewayFailovers,omitempty"`
+	Disconnects          int            `json:"disconnects"`
+	LastCloseReason      string         `json:"lastCloseReason,omitempty"`
+	LastCloseCode        int            `json:"lastCloseCode,omitempty"` // of the last close by the gateway
+	GatewayCloses        map[string]int `json:"gatewayCloses,omitempty"` // closes by the gateway per code
+	SchemaViolations     int            `json:"schemaViolations,omitempty"`
+	Violations           []string       `json:"violations,omitempty"` // the first schema violations
+	ConfigChecks         int            `json:"configChecks"`         // config_msg answers checked
+	ConfigFailureCount   int            `json:"configFailureCount,omitempty"`
+	ConfigFailures       []string       `json:"configFailures,omitempty"` // the first broken bucket invariants
+	FlowsExported        int            `json:"flowsExported,omitempty"`
+	ExportDatagrams      int            `json:"exportDatagrams,omitempty"`
+	ExportFailures       int            `json:"exportFailures,omitempty"` // flows that couldn't be sent
+	FlowsUnrouted        int            `json:"flowsUnrouted,omitempty"`  // flows whose bucket has no active primary
+	ExportsDelayed       int            `json:"exportsDelayed,omitempty"` // datagrams held back by the export rate limits
+	ReadTimeouts         int            `json:"readTimeouts,omitempty"`
+	WriteTimeouts        int            `json:"writeTimeouts,omitempty"`
+	WriteFailures        int            `json:"writeFailures,omitempty"`    // websocket writes that failed otherwise
+	MessagesTooLarge     int            `json:"messagesTooLarge,omitempty"` // gateway messages over the maximum size
+	TextFramesReceived   int            `json:"textFramesReceived"`
+	BinaryFramesReceived int            `json:"binaryFramesReceived"`
+	FramingMismatches    int            `json:"framingMismatches,omitempty"` // gateway messages in other frames than the switch's
+	InvalidUTF8          int            `json:"invalidUTF8,omitempty"`
+}
+
+func (s *Switch) count(update func(stats *Stats)) {
+	s.mu.Lock()
+	update(&s.stats)
+	s.mu.Unlock()
+}
+
+// Stats returns a copy of the switch's counters.
+func (s *Switch) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Violations = append([]string(nil), s.stats.Violations...)
+	stats.ConfigFailures = append([]string(nil), s.stats.ConfigFailures...)
+	if s.stats.GatewayCloses != nil {
+		stats.GatewayCloses = make(map[string]int, len(s.stats.GatewayCloses))
+		for code, n := range s.stats.GatewayCloses {
+			stats.GatewayCloses[code] = n
+		}
+	}
+	return stats
+}
+
+// Status is a snapshot of a switch.
+type Status struct {
+	Serial       string         `json:"serial"`
+	SwitchName   string         `json:"switchName"`
+	IP           string         `json:"ip,omitempty"` // as the check-in reports it
+	SourceIP     string         `json:"sourceIP,omitempty"`
+	MAC          string         `json:"mac"`
+	Role         string         `json:"role,omitempty"`
+	Capability   string         `json:"capability,omitempty"`
+	State        string         `json:"state"`
+	Gateway      string         `json:"gateway"`
+	Compressed   bool           `json:"compressed,omitempty"` // the websocket uses permessage-deflate
+	BufferBytes  int            `json:"bufferBytes"`          // websocket buffers held while connected
+	Framing      string         `json:"framing"`
+	AgentVersion string         `json:"agentVersion"`
+	ImageName    string         `json:"imageName"`
+	SystemUpTime string         `json:"systemUpTime"`
+	Inventory    map[string]int `json:"inventory"` // number of mappings per component
+}
+
+func (s *Switch) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{
+		Serial:       s.switchName,
+		SwitchName:   s.identity.HostName,
+		IP:           s.checkInIP(),
+		SourceIP:     s.sourceIP,
+		MAC:          s.identity.MAC,
+		Role:         s.placement.Role,
+		Capability:   s.placement.Capability,
+		State:        s.state,
+		Gateway:      s.gateways.Gateways[s.gatewayIndex].String(),
+		Compressed:   s.compressed,
+		BufferBytes:  s.heldBufferBytes(),
+		Framing:      s.framing,
+		AgentVersion: s.agentVersion,
+		ImageName:    s.imageName,
+		SystemUpTime: formatUpTime(s.clock.Now().Sub(s.bootTime)),
+		Inventory:    make(map[string]int),
+	}
+	for _, c := range s.inventory {
+		status.Inventory[c.Component] = len(c.Mappings)
+	}
+	return status
+}
@@ -0,0 +1,731 @@
+// Package switchsim simulates switches checking in with a gateway, for the
+// switch simulator and for tests that embed simulated switches:
+//
+//	s, err := switchsim.NewSwitch(switchsim.WithGateway("gateway:443"),
+//		switchsim.OnStateChange(func(s *switchsim.Switch, old, new string) { ... }))
+//	down := make(chan string, 1)
+//	s.Start(ctx, down)
+package switchsim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+)
+
+// Switch is one simulated switch. It registers with the gateway over https,
+// then checks in over a websocket and keeps answering the gateway like the
+// switch agent would.
+type Switch struct {
+	switchName      string // the serial, used as switchId
+	identity        SwitchIdentity
+	gateways        *GatewayPool
+	httpClient      *http.Client
+	websocketDialer websocket.Dialer
+	profile         *SwitchProfile
+	recorder        *sessionRecorder
+	clock           *VirtualClock
+	placement       Placement
+	sourceIP        string        // local address the switch connects from, empty for the OS's choice
+	sourceIPs       *SourceIPPool // sourceIP was taken from, nil if it wasn't
+	readTimeout     time.Duration // without a gateway message or pong, 0 for none
+	writeTimeout    time.Duration // of every websocket write, 0 for none
+	maxMessageSize  int64         // of a gateway message, 0 for no limit
+	bufferBytes     int           // websocket buffers a connected switch holds
+	closePolicy     ClosePolicy   // what to do when the gateway closes the websocket
+	reconnectDelay  time.Duration // wait before reconnecting after a gateway close
+	validation      string        // one of the Validate modes
+	framing         string        // FramingBinary or FramingText
+	strictFraming   bool          // close the websocket on unexpected gateway framing
+	trafficMix      TrafficMix
+	trafficSeed     int64
+	flowsPerSecond  int     // 0 unless WithExport is given
+	ledger          *Ledger // nil unless WithExport is given one
+	exportShape     *ExportShape
+	onMessage       []func(s *Switch, direction string, message []byte)
+	onStateChange   []func(s *Switch, old string, new string)
+	onConfig        []func(s *Switch, config *ServerConfigMessage)
+
+	mu              sync.Mutex
+	gatewayIndex    int // in gateways of the gateway the switch uses now
+	agentVersion    string
+	imageName       string
+	bootTime        time.Time   // on the virtual clock
+	modTs           time.Time   // last inventory change, on the virtual clock
+	connection      *connection // nil while the switch is disconnected
+	compressed      bool        // the gateway accepted permessage-deflate on the last websocket
+	state           string
+	inventory       []inventoryComponent
+	collectorConfig *ServerConfigMessage // the last config_msg the gateway sent
+	faults          *faultInjector       // nil unless WithFaults is given
+	export          exportState          // has its own lock
+	watchers        map[int]func(direction string, message []byte)
+	nextWatcher     int
+	stats           Stats
+}
+
+// States of a switch.
+const (
+	StateRegistering  = "registering"
+	StateConnected    = "connected"
+	StateDisconnected = "disconnected" // closed by the simulator, e.g. from the admin API
+	StateRebooting    = "rebooting"
+	StateDown         = "down"         // registration failed or the websocket died
+	StateReconnecting = "reconnecting" // closed by the gateway, coming back as the close policy says
+)
+
+type channelMessage struct {
+	Cmd     string
+	Message []byte
+}
+
+// connection is one websocket session of a switch, a reconnect gets a new one.
+// Cancelling ctx stops the session's goroutines.
+type connection struct {
+	conn       *websocket.Conn
+	toSender   chan channelMessage
+	parent     context.Context // the session was opened with, for reconnects
+	ctx        context.Context
+	cancel     context.CancelFunc
+	closeOnce  sync.Once
+	pending    int32           // requests waiting for the gateway's response
+	goroutines sync.WaitGroup  // sender, receiver, validator and exporter
+	readerDone chan struct{}   // closed when the receiver returns
+	writeErr   error           // the write that broke the websocket, set by the sender
+	held       *channelMessage // held back by the reorder fault for the next message, set by the sender
+}
+
+// close sends the gateway a close frame and ends the session. With a linger
+// it first waits that long for the gateway to answer the close frame. close
+// reports whether this call was the one ending the session, so that a dead
+// switch is reported to the main loop only once.
+func (c *connection) close(code int, reason string, linger time.Duration) bool {
+	closed := false
+	c.closeOnce.Do(func() {
+		c.cancel()
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		if linger > 0 {
+			select {
+			case <-c.readerDone:
+			case <-time.After(linger):
+			}
+		}
+		c.conn.Close()
+		closed = true
+	})
+	return closed
+}
+
+// NewSwitch creates a switch, it doesn't register it.
+func NewSwitch(options ...Option) (*Switch, error) {
+	c := newConfig(options)
+	if c.gateways == nil || len(c.gateways.Gateways) == 0 {
+		return nil, errors.New("no gateway given")
+	}
+	identity := SwitchIdentity{Serial: c.profile.Serial, HostName: c.profile.SwitchName}
+	if c.identity != nil {
+		identity = *c.identity
+	}
+	sourceIP := c.sourceIP
+	var sourceIPs *SourceIPPool
+	if sourceIP == "" && c.sourceIPs != nil {
+		var err error
+		if sourceIP, err = c.sourceIPs.take(); err != nil {
+			return nil, err
+		}
+		sourceIPs = c.sourceIPs
+	}
+	s, err := newSwitch(c, identity, sourceIP)
+	if err != nil {
+		if sourceIPs != nil {
+			sourceIPs.release(sourceIP)
+		}
+		return nil, err
+	}
+	s.sourceIPs = sourceIPs
+	return s, nil
+}
+
+func newSwitch(c *config, identity SwitchIdentity, sourceIP string) (*Switch, error) {
+	switchName := identity.Serial
+	framing := c.framing
+	if framing == "" {
+		framing = c.profile.Framing
+	}
+	framing, err := ParseFraming(framing)
+	if err != nil {
+		return nil, err
+	}
+	dial, err := c.transport.dialer(sourceIP)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, websocketDialer, err := c.transport.clients(c.tlsConfig, dial)
+	if err != nil {
+		return nil, err
+	}
+	var checkIn SwitchCheckInMessage
+	if err := json.Unmarshal(c.profile.CheckIn, &checkIn); err != nil {
+		glog.Errorf(switchName+": Can't unmarshal profile switch/check_in message: %v\n", err)
+	}
+	upTime, err := parseUpTime(checkIn.Data.SystemUpTime)
+	if err != nil {
+		glog.Errorf(switchName+": Can't parse profile systemUpTime: %v\n", err)
+	}
+	if c.upTime > 0 {
+		upTime = c.upTime
+	}
+	s := &Switch{
+		switchName:      switchName,
+		identity:        identity,
+		gateways:        c.gateways,
+		gatewayIndex:    c.gateways.assign(switchName),
+		httpClient:      httpClient,
+		websocketDialer: websocketDialer,
+		profile:         c.profile,
+		clock:           c.clock,
+		placement:       c.placement,
+		sourceIP:        sourceIP,
+		readTimeout:     c.transport.ReadTimeout,
+		writeTimeout:    c.transport.WriteTimeout,
+		maxMessageSize:  c.transport.MaxMessageSize,
+		bufferBytes:     c.transport.bufferBytes(),
+		closePolicy:     c.closePolicy,
+		reconnectDelay:  c.reconnectDelay,
+		validation:      c.validation,
+		framing:         framing,
+		strictFraming:   c.strictFraming,
+		trafficMix:      c.trafficMix,
+		trafficSeed:     c.trafficSeed,
+		flowsPerSecond:  c.flowsPerSecond,
+		ledger:          c.ledger,
+		exportShape:     c.exportShape,
+		onMessage:       c.onMessage,
+		onStateChange:   c.onStateChange,
+		onConfig:        c.onConfig,
+		agentVersion:    checkIn.Data.AgentVersion,
+		imageName:       checkIn.Data.ImageName,
+		bootTime:        c.clock.Now().Add(-upTime),
+		modTs:           c.clock.Now(),
+		state:           StateRegistering,
+	}
+	s.export.wake = make(chan struct{}, 1)
+	if err = s.loadInventory(); err != nil {
+		return nil, err
+	}
+	if c.faults != nil {
+		s.faults = newFaultInjector(c.faults, s.switchName)
+		s.websocketDialer.NetDialContext = s.faults.dialer(dial)
+	}
+	if c.recordDir != "" {
+		if s.recorder, err = newSessionRecorder(c.recordDir, s.switchName); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Serial is the switch's serial, which it uses as switchId.
+func (s *Switch) Serial() string {
+	return s.switchName
+}
+
+func (s *Switch) Identity() SwitchIdentity {
+	return s.identity
+}
+
+func (s *Switch) setState(state string) {
+	s.mu.Lock()
+	notify := s.changeState(state)
+	s.mu.Unlock()
+	notify()
+}
+
+// changeState sets the state, s.mu held, and returns the function calling the
+// OnStateChange callbacks, to be called once s.mu is released.
+func (s *Switch) changeState(state string) func() {
+	old := s.state
+	s.state = state
+	if old == state || len(s.onStateChange) == 0 {
+		return func() {}
+	}
+	return func() {
+		for _, fn := range s.onStateChange {
+			fn(s, old, state)
+		}
+	}
+}
+
+// State is one of the State constants.
+func (s *Switch) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Send forwards a message to the sender of the current websocket, it returns
+// false if the switch isn't connected.
+func (s *Switch) Send(cmd string, message []byte) bool {
+	s.mu.Lock()
+	c := s.connection
+	s.mu.Unlock()
+	if c == nil {
+		return false
+	}
+	glog.Infof(s.switchName + ": forwarding " + cmd + " message to sender\n")
+	return c.forward(channelMessage{cmd, message})
+}
+
+// forward queues a message for the sender, it returns false if the session
+// ended first.
+func (c *connection) forward(m channelMessage) bool {
+	select {
+	case c.toSender <- m:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// disconnected is called by the goroutines of a connection when the session
+// fails, it closes the websocket with the given code and reason and tells the
+// main loop that the switch is down.
+func (s *Switch) disconnected(c *connection, code int, reason string, allToMainLoop chan string) {
+	if s.drop(c, code, reason, StateDown) {
+		allToMainLoop <- s.switchName
+	}
+}
+
+// drop closes a failed session and leaves the switch in the given state, it
+// reports whether this call was the one ending the session.
+func (s *Switch) drop(c *connection, code int, reason string, state string) bool {
+	if !c.close(code, reason, 0) {
+		return false
+	}
+	notify := func() {}
+	s.mu.Lock()
+	if s.connection == c {
+		s.connection = nil
+		notify = s.changeState(state)
+	}
+	s.stats.Disconnects++
+	s.stats.LastCloseReason = reason
+	s.mu.Unlock()
+	notify()
+	return true
+}
+
+// disconnect closes the websocket on purpose and leaves the switch in the
+// given state, the main loop isn't told.
+func (s *Switch) disconnect(state string) {
+	s.mu.Lock()
+	c := s.connection
+	s.connection = nil
+	notify := s.changeState(state)
+	if c != nil {
+		s.stats.Disconnects++
+		s.stats.LastCloseReason = "closed by simulator"
+	}
+	s.mu.Unlock()
+	notify()
+	if c != nil {
+		c.close(websocket.CloseNormalClosure, "closed by simulator", time.Second)
+		glog.Infof(s.switchName + ": websocket closed by simulator\n")
+	}
+}
+
+// Shutdown stops new messages, waits until the gateway has answered the
+// requests in flight or the deadline passes, then closes the websocket with a
+// going away close frame and waits for the session's goroutines to stop.
+func (s *Switch) Shutdown(deadline time.Time) {
+	s.mu.Lock()
+	c := s.connection
+	s.connection = nil
+	notify := s.changeState(StateDisconnected)
+	s.mu.Unlock()
+	notify()
+	if c == nil {
+		return
+	}
+	for atomic.LoadInt32(&c.pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	unanswered := int(atomic.LoadInt32(&c.pending))
+	if unanswered > 0 {
+		glog.Infof(s.switchName+": %d requests unanswered at shutdown\n", unanswered)
+	}
+	s.mu.Lock()
+	s.stats.Unanswered += unanswered
+	s.stats.Disconnects++
+	s.stats.LastCloseReason = "switch simulator shutting down"
+	s.mu.Unlock()
+	c.close(websocket.CloseGoingAway, "switch simulator shutting down", time.Until(deadline))
+	c.goroutines.Wait()
+	glog.Infof(s.switchName + ": websocket closed for shutdown\n")
+}
+
+func (s *Switch) sender(c *connection, senderToValidator chan string, allToMainLoop chan string) {
+	defer c.goroutines.Done()
+	for {
+		var m channelMessage
+		select {
+		case m = <-c.toSender:
+		case <-c.ctx.Done():
+			return
+		}
+		sent, ok := s.writeMessage(c, m)
+		if !ok {
+			if c.ctx.Err() == nil {
+				s.gatewayClosed(c, c.writeErr, allToMainLoop)
+			}
+			return
+		}
+		for _, m := range sent {
+			glog.Infof(s.switchName + ": " + m.Cmd + " message sent\n")
+			switch m.Cmd {
+			case "switch/check_in", "switch/config_msg", "switch/add_mapping":
+				atomic.AddInt32(&c.pending, 1)
+				select {
+				case senderToValidator <- m.Cmd:
+				case <-c.ctx.Done():
+					return
+				}
+			default: //todo: add other response to server's command
+			}
+		}
+	}
+}
+
+// writeFrame writes a message to the websocket within the write timeout. On
+// failure it keeps the error for the sender, the websocket is broken then.
+func (s *Switch) writeFrame(c *connection, message []byte) bool {
+	if s.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	}
+	err := c.conn.WriteMessage(frameType(s.framing), message)
+	if err == nil {
+		return true
+	}
+	if c.ctx.Err() != nil { // closed by the simulator
+		return false
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		glog.Errorf(s.switchName+": websocket write timed out after %v\n", s.writeTimeout)
+		s.count(func(stats *Stats) { stats.WriteTimeouts++ })
+	} else {
+		glog.Errorf(s.switchName+": Can't write to websocket: %v\n", err)
+		s.count(func(stats *Stats) { stats.WriteFailures++ })
+	}
+	c.writeErr = err
+	return false
+}
+
+// pinger pings the gateway every half read timeout, so an idle but healthy
+// websocket gets pongs that push the read deadline forward.
+func (s *Switch) pinger(c *connection) {
+	defer c.goroutines.Done()
+	ticker := time.NewTicker(s.readTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+		if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.readTimeout)); err != nil {
+			return // the receiver sees the websocket fail
+		}
+	}
+}
+
+func (s *Switch) receiver(c *connection, receiverToValidator chan string, allToMainLoop chan string) {
+	defer c.goroutines.Done()
+	defer close(c.readerDone)
+	for {
+		if s.readTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+		}
+		messageType, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.ctx.Err() != nil { // closed by the simulator
+				return
+			}
+			if err == websocket.ErrReadLimit {
+				glog.Errorf(s.switchName+": gateway message larger than %d bytes\n", s.maxMessageSize)
+				s.count(func(stats *Stats) { stats.MessagesTooLarge++ })
+				s.disconnected(c, websocket.CloseMessageTooBig, "gateway message too large", allToMainLoop)
+				return
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				s.readTimedOut(c, allToMainLoop)
+				return
+			}
+			s.gatewayClosed(c, err, allToMainLoop)
+			return
+		}
+		s.observe("recv", message)
+		if code, reason := s.checkFraming(messageType, message); code != 0 {
+			s.disconnected(c, code, reason, allToMainLoop)
+			return
+		}
+		if s.validation != ValidateOff && !s.validate(message) && s.validation == ValidateStrict {
+			s.disconnected(c, websocket.CloseInvalidFramePayloadData, "schema violation", allToMainLoop)
+			return
+		}
+		var serverMessage ServerMessage //for the cmd value
+		err = json.Unmarshal(message, &serverMessage)
+		if err != nil {
+			glog.Errorf(s.switchName+": Can't unmarshal websocket message: %v\n", err)
+			s.disconnected(c, websocket.CloseInvalidFramePayloadData, "can't unmarshal message", allToMainLoop)
+			return
+		}
+		glog.Infof(s.switchName + ": Server's " + serverMessage.Cmd + " message received\n")
+		switch serverMessage.Cmd {
+		case "switch/check_in", "switch/config_msg", "switch/add_mapping":
+			select {
+			case receiverToValidator <- serverMessage.Cmd:
+			case <-c.ctx.Done():
+				return
+			}
+		}
+		switch serverMessage.Cmd {
+		case "switch/config_msg":
+			var serverConfigMessage ServerConfigMessage
+			if err = json.Unmarshal(message, &serverConfigMessage); err != nil {
+				glog.Errorf(s.switchName+": Can't unmarshal switch/config_msg message: %v\n", err)
+				s.count(func(stats *Stats) {
+					stats.ConfigFailureCount++
+					if len(stats.ConfigFailures) < maxConfigFailures {
+						stats.ConfigFailures = append(stats.ConfigFailures, "can't unmarshal: "+err.Error())
+					}
+				})
+			} else {
+				s.checkConfig(&serverConfigMessage)
+			}
+		default: //todo: add other server's command --> generate response -->forward to sender
+		}
+	}
+}
+
+func (s *Switch) validator(c *connection, senderToValidator chan string, receiverToValidator chan string, allToMainLoop chan string) {
+	defer c.goroutines.Done()
+	for {
+		var ms string
+		select {
+		case ms = <-senderToValidator:
+		case <-c.ctx.Done():
+			return
+		}
+		timeOut := time.After(30 * time.Second)
+		for f := true; f == true; {
+			select {
+			case mr := <-receiverToValidator:
+				atomic.AddInt32(&c.pending, -1)
+				if mr == ms {
+					glog.Infof(s.switchName + ": request " + ms + " and response " + mr + " matched\n")
+					s.count(func(stats *Stats) { stats.Matched++ })
+					f = false
+					break
+				} else {
+					glog.Infof(s.switchName + ": Validation error! request " + ms + " and response " + mr + " unmatched\n")
+					s.count(func(stats *Stats) { stats.Mismatched++ })
+					s.disconnected(c, websocket.ClosePolicyViolation, "response "+mr+" doesn't match request "+ms, allToMainLoop)
+					return
+				}
+			case <-timeOut:
+				atomic.AddInt32(&c.pending, -1)
+				glog.Infof(s.switchName + ": Timeout waiting for " + ms + " response\n")
+				s.count(func(stats *Stats) { stats.Timeouts++ })
+				s.disconnected(c, websocket.CloseGoingAway, "timeout waiting for "+ms+" response", allToMainLoop)
+				return
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (s *Switch) marshalMessage(cmd string, message interface{}) ([]byte, bool) {
+	jsonMessage, err := json.Marshal(message)
+	if err != nil {
+		glog.Errorf(s.switchName+": Can't marshal "+cmd+" message: %v\n", err)
+		return nil, false
+	} else {
+		return jsonMessage, true
+	}
+}
+
+func (s *Switch) WebSocketRequest(ctx context.Context, allToMainLoop chan string) bool { //return false if websocket creation fails
+	gateway := s.gateway()
+	websocketURL := gateway.websocketURL()
+	conn, response, err := s.websocketDialer.DialContext(ctx, websocketURL.String(), nil)
+	if err != nil {
+		glog.Errorf(s.switchName+": Can't make websocket to %s: %v\n", gateway.Websocket, err)
+		return false
+	}
+	if s.maxMessageSize > 0 {
+		conn.SetReadLimit(s.maxMessageSize)
+	}
+	compressed := strings.Contains(response.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+	if compressed {
+		glog.Infof(s.switchName + ": Websocket established, compressed\n")
+	} else {
+		glog.Infof(s.switchName + ": Websocket established\n")
+	}
+
+	c := &connection{conn: conn, toSender: make(chan channelMessage, 10), parent: ctx, readerDone: make(chan struct{})}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	senderToValidator := make(chan string, 10)
+	receiverToValidator := make(chan string, 10)
+	s.mu.Lock()
+	s.connection = c
+	s.compressed = compressed
+	notify := s.changeState(StateConnected)
+	s.stats.Connects++
+	s.mu.Unlock()
+	notify()
+
+	c.goroutines.Add(3)
+	go s.sender(c, senderToValidator, allToMainLoop)
+	go s.receiver(c, receiverToValidator, allToMainLoop)
+	go s.validator(c, senderToValidator, receiverToValidator, allToMainLoop)
+	if s.flowsPerSecond > 0 {
+		c.goroutines.Add(1)
+		go s.exporter(c)
+	}
+	if s.readTimeout > 0 {
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+		})
+		c.goroutines.Add(1)
+		go s.pinger(c)
+	}
+
+	// If the session ends before these are queued, whoever ended it has told
+	// the main loop.
+	cm := channelMessage{"switch/check_in", s.CheckInMessage()}
+	glog.Infof(s.switchName + ": forwarding switch/check_in message to sender\n")
+	if !c.forward(cm) {
+		return true
+	}
+	cm = channelMessage{"switch/config_msg", s.ConfigMessage()}
+	glog.Infof(s.switchName + ": forwarding switch/config_msg message to sender\n")
+	if !c.forward(cm) {
+		return true
+	}
+	for _, m := range s.AddMappingMessages() {
+		cm = channelMessage{"switch/add_mapping", m}
+		glog.Infof(s.switchName + ": forwarding switch/add_mapping message to sender\n")
+		if !c.forward(cm) {
+			return true
+		}
+	}
+	/*checkInMessage := s.CheckInMessage()
+	cmd := "switch/check_in"
+	jsonCheckInMessage, flag := s.marshalMessage(cmd, checkInMessage)
+	if !flag {
+		glog.Infof(s.switchName + ": closing websocket\n")
+		defer conn.Close()
+		allToMainLoop <- s.switchName
+		return false
+	}
+	message := channelMessage{cmd, jsonCheckInMessage}
+	glog.Infof(s.switchName + ": forwarding " + cmd + " message to sender\n")
+	toSender <- message
+
+	configMessage := s.ConfigMessage()
+	cmd = "switch/config_msg"
+	jsonConfigMessage, flag := s.marshalMessage(cmd, configMessage)
+	if !flag {
+		glog.Infof(s.switchName + ": closing websocket\n")
+		defer conn.Close()
+		allToMainLoop <- s.switchName
+		return false
+	}
+	message = channelMessage{cmd, jsonConfigMessage}
+	glog.Infof(s.switchName + ": forwarding " + cmd + " message to sender\n")
+	toSender <- message*/
+
+	return true
+}
+
+func (s *Switch) httpsRequest(ctx context.Context) bool { //return false if registration fails
+	switchRegistration := SwitchRegistration{Serial: s.switchName, Crt: ""} //Solenoid replaces its cert with switch cert
+	jsonSwitchRegistration, err := json.Marshal(switchRegistration)
+	if err != nil {
+		glog.Errorf(s.switchName+": Can't marshal https registration request: %v\n", err)
+		return false
+	}
+	jsonSwitchRegistration, post := s.registrationFaults(ctx, jsonSwitchRegistration)
+	if !post {
+		return true
+	}
+	gateway := s.gateway()
+	registerURL := gateway.registerURL()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, registerURL.String(), bytes.NewReader(jsonSwitchRegistration))
+	if err != nil {
+		glog.Errorf(s.switchName+": Can't create https registration request: %v\n", err)
+		return false
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		glog.Errorf(s.switchName+": Error getting https reponse from %s: %v\n", gateway.Register, err)
+		return false
+	}
+	response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		glog.Errorf(s.switchName+": https registration with %s failed: %s\n", gateway.Register, response.Status)
+		return false
+	}
+	return true
+}
+
+// Start registers the switch and opens its websocket, it returns false if
+// either fails. The serial is sent on down every time the switch goes down,
+// so down has to be drained.
+func (s *Switch) Start(ctx context.Context, down chan string) bool {
+	return s.register(ctx, down)
+}
+
+// Disconnect closes the websocket, the switch stays down until it is started
+// again.
+func (s *Switch) Disconnect() {
+	s.disconnect(StateDisconnected)
+}
+
+// register runs the https registration and opens the websocket, failing over
+// to the next gateway of the pool when either fails. It returns false if they
+// fail with every gateway.
+func (s *Switch) register(ctx context.Context, allToMainLoop chan string) bool {
+	s.setState(StateRegistering)
+	for attempt := 0; attempt < len(s.gateways.Gateways); attempt++ {
+		if attempt > 0 && (ctx.Err() != nil || !s.failover()) {
+			break
+		}
+		glog.Infof(s.switchName + ": Sending https request\n")
+		if !s.httpsRequest(ctx) {
+			glog.Infof(s.switchName + ": https request failed\n")
+			continue
+		}
+		glog.Infof(s.switchName + ": https request succeeded\n")
+		glog.Infof(s.switchName + ": Sending websocket request\n")
+		if !s.WebSocketRequest(ctx, allToMainLoop) {
+			glog.Infof(s.switchName + ": Websocket request failed\n")
+			continue
+		}
+		return true
+	}
+	s.setState(StateDown)
+	return false
+}
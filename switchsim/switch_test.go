@@ -0,0 +1,114 @@
+package switchsim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testGateway serves the https registration and hands every websocket to
+// session, it returns the gateway's host:port.
+func testGateway(t *testing.T, session func(conn *websocket.Conn)) string {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/switch_register", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/switch_wss", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		session(conn)
+	})
+	gateway := httptest.NewTLSServer(mux)
+	t.Cleanup(gateway.Close)
+	return strings.TrimPrefix(gateway.URL, "https://")
+}
+
+// startSwitch registers s and returns the channel it reports going down on.
+func startSwitch(t *testing.T, s *Switch) chan string {
+	down := make(chan string, 10)
+	if !s.Start(context.Background(), down) {
+		t.Fatal("switch failed to register")
+	}
+	t.Cleanup(s.Disconnect)
+	return down
+}
+
+func TestCheckInKeepsProfileFields(t *testing.T) {
+	received := make(chan []byte, 1)
+	gateway := testGateway(t, func(conn *websocket.Conn) {
+		_, message, err := conn.ReadMessage()
+		if err == nil {
+			received <- message
+		}
+		conn.ReadMessage() // until the switch disconnects
+	})
+	profile := DefaultProfile
+	profile.CheckIn = json.RawMessage(`{"cmd":"switch/check_in","switchId":"{{serial}}","extra":[1,2],` +
+		`"data":{"switch_name":"{{switchName}}","systemUpTime":"1:00:00:00.000","agentVersion":"3.1","serialBig":12345678901234567890,"vpc":{"domain":7}}}`)
+	placement := Placement{Role: "spine"}
+	s, err := NewSwitch(WithGateway(gateway), WithProfile(&profile), WithPlacement(placement), WithUpTime(time.Hour),
+		WithIdentity(SwitchIdentity{Serial: "FDO1", HostName: "leaf1", IP: "10.0.0.1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startSwitch(t, s)
+	var message []byte
+	select {
+	case message = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no check-in reached the gateway")
+	}
+	for _, want := range []string{`"extra":[1,2]`, `"serialBig":12345678901234567890`, `"vpc":{"domain":7}`, `"switch_name":"leaf1"`, `"role":"spine"`, `"ip":"10.0.0.1"`, `"systemUpTime":"00:01:00:0`} {
+		if !strings.Contains(string(message), want) {
+			t.Errorf("check-in %s doesn't have %s", message, want)
+		}
+	}
+}
+
+func TestConfigMessageNotWrittenToDisk(t *testing.T) {
+	gateway := testGateway(t, func(conn *websocket.Conn) {
+		for _, answer := range []string{
+			`{"cmd":"switch/check_in","responseCode":200}`,
+			`{"cmd":"switch/config_msg","responseCode":200,"data":{"buckets":[{"lo":0,"hi":65535,"primary":"c1","secondary":"c2"}]}}`,
+		} {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			conn.WriteMessage(websocket.BinaryMessage, []byte(answer))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	configs := make(chan *ServerConfigMessage, 1)
+	s, err := NewSwitch(WithGateway(gateway), WithIdentity(SwitchIdentity{Serial: "FDOCFG1", HostName: "leaf1"}),
+		OnConfig(func(s *Switch, config *ServerConfigMessage) { configs <- config }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startSwitch(t, s)
+	select {
+	case <-configs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no config_msg from the gateway")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if state := s.State(); state != StateConnected {
+		t.Errorf("switch %s after config_msg, want %s", state, StateConnected)
+	}
+	if _, err := os.Stat("FDOCFG1ConfigMessage"); !os.IsNotExist(err) {
+		os.Remove("FDOCFG1ConfigMessage")
+		t.Error("config_msg was written to the working directory")
+	}
+}
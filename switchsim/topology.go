@@ -0,0 +1,114 @@
+package switchsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	RoleSpine      = "spine"
+	RoleLeaf       = "leaf"
+	RoleBorderLeaf = "border-leaf"
+
+	CapabilityStandalone = "standalone"
+	CapabilityFabric     = "fabric"
+)
+
+// TopologyGroup is a set of identical switches in the topology file.
+type TopologyGroup struct {
+	Role       string   `json:"role"`       // spine, leaf or border-leaf
+	Capability string   `json:"capability"` // standalone or fabric, default standalone
+	Count      int      `json:"count"`
+	NamePrefix string   `json:"namePrefix"` // switch_name is <namePrefix><n>, default <ROLE>-
+	IPs        []string `json:"ips"`        // management IPs in switch order, may be shorter than count
+}
+
+// Topology is the fabric description, loaded by the simulator with -topology, e.g.
+//
+//	{"gatewayUUID": "...", "switches": [
+//	  {"role": "spine", "capability": "fabric", "count": 2},
+//	  {"role": "leaf", "capability": "fabric", "count": 8, "namePrefix": "LEAF-"},
+//	  {"role": "border-leaf", "capability": "fabric", "count": 2},
+//	  {"role": "leaf", "count": 1, "namePrefix": "STANDALONE-LEAF"}]}
+type Topology struct {
+	GatewayUUID string          `json:"gatewayUUID"` // reported by fabric-managed switches
+	Groups      []TopologyGroup `json:"switches"`
+}
+
+// Placement is one switch as placed by the topology. Empty fields keep
+// the profile's values.
+type Placement struct {
+	HostName    string
+	Role        string
+	Capability  string
+	IP          string
+	GatewayUUID string
+}
+
+func LoadTopology(fileName string) (*Topology, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var t Topology
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	for i, g := range t.Groups {
+		switch g.Role {
+		case RoleSpine, RoleLeaf, RoleBorderLeaf:
+		default:
+			return nil, fmt.Errorf("switch group %d: unknown role %q", i, g.Role)
+		}
+		switch g.Capability {
+		case "", CapabilityStandalone, CapabilityFabric:
+		default:
+			return nil, fmt.Errorf("switch group %d: unknown capability %q", i, g.Capability)
+		}
+		if g.Count < 1 {
+			return nil, fmt.Errorf("switch group %d: count must be at least 1", i)
+		}
+	}
+	return &t, nil
+}
+
+// Placements expands the topology into one placement per switch.
+func (t *Topology) Placements() []Placement {
+	var placements []Placement
+	for _, g := range t.Groups {
+		prefix := g.NamePrefix
+		if prefix == "" {
+			prefix = strings.ToUpper(g.Role) + "-"
+		}
+		capability := g.Capability
+		if capability == "" {
+			capability = CapabilityStandalone
+		}
+		for n := 0; n < g.Count; n++ {
+			p := Placement{
+				HostName:   fmt.Sprintf("%s%d", prefix, n+1),
+				Role:       g.Role,
+				Capability: capability,
+			}
+			if n < len(g.IPs) {
+				p.IP = g.IPs[n]
+			}
+			if capability == CapabilityFabric {
+				p.GatewayUUID = t.GatewayUUID
+			}
+			placements = append(placements, p)
+		}
+	}
+	return placements
+}
+
+// exportPort is the collector port the switch exports to, spines use the
+// collector's dedicated spine port.
+func (s *Switch) exportPort(c CollectorMessage) int {
+	if s.placement.Role == RoleSpine {
+		return c.SpineUDPPort
+	}
+	return c.UDPPort
+}
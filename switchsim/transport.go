@@ -0,0 +1,124 @@
+package switchsim
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport is how switches reach their gateways.
+type Transport struct {
+	// Proxy is http://[user:pass@]host:port for an HTTP CONNECT proxy or
+	// socks5://[user:pass@]host:port, empty to connect directly.
+	Proxy            string
+	ConnectTimeout   time.Duration // of the TCP connect, 0 for the OS default
+	HandshakeTimeout time.Duration // of the TLS and websocket handshakes
+	// ReadTimeout is the timeout of the registration response, and how long a
+	// websocket may go without a gateway message or pong, 0 for no limit. The
+	// switch pings the gateway every half of it.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration // of every websocket write, 0 for none
+
+	// Websocket buffer sizes, 0 for gorilla's 4096 bytes. With a
+	// WriteBufferPool the switches share write buffers, a websocket only holds
+	// one while it writes.
+	ReadBufferSize  int
+	WriteBufferSize int
+	WriteBufferPool websocket.BufferPool
+	Compression     bool  // offer the gateway permessage-deflate
+	MaxMessageSize  int64 // of a gateway message, 0 for no limit
+}
+
+// defaultBufferSize is gorilla's websocket buffer size.
+const defaultBufferSize = 4096
+
+// DefaultTransport connects directly.
+var DefaultTransport = Transport{ConnectTimeout: 30 * time.Second, HandshakeTimeout: 45 * time.Second}
+
+// proxyURL parses the proxy, nil if there is none.
+func (t Transport) proxyURL() (*url.URL, error) {
+	if t.Proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(t.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "socks5") || u.Host == "" {
+		return nil, fmt.Errorf("proxy %q is not http://host:port or socks5://host:port", t.Proxy)
+	}
+	return u, nil
+}
+
+// Validate checks the proxy and the sizes.
+func (t Transport) Validate() error {
+	if t.ReadBufferSize < 0 || t.WriteBufferSize < 0 || t.MaxMessageSize < 0 {
+		return errors.New("websocket buffer and message sizes can't be negative")
+	}
+	_, err := t.proxyURL()
+	return err
+}
+
+// bufferBytes is how much buffer a connected websocket holds between writes.
+func (t Transport) bufferBytes() int {
+	size := func(n int) int {
+		if n == 0 {
+			return defaultBufferSize
+		}
+		return n
+	}
+	if t.WriteBufferPool != nil {
+		return size(t.ReadBufferSize)
+	}
+	return size(t.ReadBufferSize) + size(t.WriteBufferSize)
+}
+
+// dialer returns what dials the TCP connections to the gateway, or to the
+// proxy, from sourceIP unless it is empty.
+func (t Transport) dialer(sourceIP string) (func(ctx context.Context, network string, addr string) (net.Conn, error), error) {
+	d := &net.Dialer{Timeout: t.ConnectTimeout}
+	if sourceIP != "" {
+		ip := net.ParseIP(sourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("source IP %q is not an IP address", sourceIP)
+		}
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return d.DialContext, nil
+}
+
+// clients builds the https client of the registration and the websocket
+// dialer of a switch.
+func (t Transport) clients(tlsConfig *tls.Config, dial func(ctx context.Context, network string, addr string) (net.Conn, error)) (*http.Client, websocket.Dialer, error) {
+	proxy, err := t.proxyURL()
+	if err != nil {
+		return nil, websocket.Dialer{}, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dial,
+		TLSHandshakeTimeout:   t.HandshakeTimeout,
+		ResponseHeaderTimeout: t.ReadTimeout,
+	}
+	websocketDialer := websocket.Dialer{
+		HandshakeTimeout:  t.HandshakeTimeout,
+		TLSClientConfig:   tlsConfig,
+		NetDialContext:    dial,
+		ReadBufferSize:    t.ReadBufferSize,
+		WriteBufferSize:   t.WriteBufferSize,
+		WriteBufferPool:   t.WriteBufferPool,
+		EnableCompression: t.Compression,
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+		websocketDialer.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport}, websocketDialer, nil
+}
@@ -0,0 +1,94 @@
+package switchsim
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWriteTimeoutEndsSession(t *testing.T) {
+	stalled := make(chan struct{})
+	gateway := testGateway(t, func(conn *websocket.Conn) { <-stalled }) // never reads
+	t.Cleanup(func() { close(stalled) })
+	transport := DefaultTransport
+	transport.WriteTimeout = 200 * time.Millisecond
+	s, err := NewSwitch(WithGateway(gateway), WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := startSwitch(t, s)
+	large := append(append([]byte(`{"cmd":"switch/test","data":"`), bytes.Repeat([]byte("x"), 1<<20)...), `"}`...)
+	deadline := time.After(10 * time.Second)
+	for s.Send("switch/test", large) {
+		select {
+		case <-deadline:
+			t.Fatal("the stalled gateway took every write")
+		default:
+		}
+	}
+	select {
+	case <-down:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the switch wasn't reported down")
+	}
+	if stats := s.Stats(); stats.WriteTimeouts != 1 || stats.WriteFailures != 0 {
+		t.Errorf("%d write timeouts and %d write failures, want 1 and 0", stats.WriteTimeouts, stats.WriteFailures)
+	}
+	if state := s.State(); state == StateConnected {
+		t.Errorf("switch %s after the write timed out", state)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	gateway := testGateway(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.BinaryMessage, bytes.Repeat([]byte(" "), 4096))
+		conn.ReadMessage()
+	})
+	transport := DefaultTransport
+	transport.MaxMessageSize = 1024
+	s, err := NewSwitch(WithGateway(gateway), WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := startSwitch(t, s)
+	select {
+	case <-down:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the switch took a message over the maximum size")
+	}
+	if stats := s.Stats(); stats.MessagesTooLarge != 1 || stats.LastCloseReason != "gateway message too large" {
+		t.Errorf("%d messages too large, last close %q, want 1 and gateway message too large", stats.MessagesTooLarge, stats.LastCloseReason)
+	}
+}
+
+func TestCompressionAndBuffers(t *testing.T) {
+	gateway := testGateway(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	for _, compression := range []bool{false, true} {
+		transport := DefaultTransport
+		transport.Compression = compression
+		transport.ReadBufferSize = 1024
+		transport.WriteBufferSize = 2048
+		s, err := NewSwitch(WithGateway(gateway), WithTransport(transport))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := s.Status().BufferBytes; n != 0 {
+			t.Errorf("disconnected switch holds %d buffer bytes", n)
+		}
+		startSwitch(t, s)
+		status := s.Status()
+		if status.Compressed != compression || status.BufferBytes != 3072 {
+			t.Errorf("compression %v: compressed %v with %d buffer bytes, want %v and 3072", compression, status.Compressed, status.BufferBytes, compression)
+		}
+		s.Disconnect()
+	}
+}
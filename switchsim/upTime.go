@@ -0,0 +1,32 @@
+package switchsim
+
+import (
+	"fmt"
+	"time"
+)
+
+// formatUpTime renders an uptime the way the switch agent reports
+// systemUpTime: DD:HH:MM:SS.mmm.
+func formatUpTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := int64(d / time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d:%02d.%03d", ms/86400000, ms/3600000%24, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// formatModTs renders a timestamp the way NX-OS reports modTs.
+func formatModTs(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000-07:00")
+}
+
+func parseUpTime(upTime string) (time.Duration, error) {
+	if upTime == "" {
+		return 0, nil
+	}
+	var days, hours, minutes, seconds, ms int64
+	if _, err := fmt.Sscanf(upTime, "%d:%d:%d:%d.%d", &days, &hours, &minutes, &seconds, &ms); err != nil {
+		return 0, fmt.Errorf("bad systemUpTime %q: %v", upTime, err)
+	}
+	return time.Duration(((days*24+hours)*60+minutes)*60+seconds)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
@@ -0,0 +1,70 @@
+package switchsim
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// UpgradePlan describes a rolling agent/NX-OS upgrade across the fleet.
+type UpgradePlan struct {
+	AgentVersion string        // new agentVersion, unchanged if empty
+	ImageName    string        // new imageName, unchanged if empty
+	Start        time.Duration // delay after registration before the first batch
+	BatchSize    int           // switches upgraded at the same time
+	Interval     time.Duration // delay between the start of two batches
+	RebootTime   time.Duration // how long a switch stays down
+}
+
+// upgrade takes the switch down for the reboot time and brings it back up
+// checking in with the new version and image and a fresh systemUpTime.
+func (s *Switch) upgrade(ctx context.Context, plan UpgradePlan, allToMainLoop chan string) {
+	if s.State() != StateConnected {
+		glog.Infof(s.switchName + ": not connected, skipping upgrade\n")
+		return
+	}
+	glog.Infof(s.switchName + ": upgrading, going down for " + plan.RebootTime.String() + "\n")
+	s.disconnect(StateRebooting)
+	if !s.clock.Sleep(ctx, plan.RebootTime) {
+		return
+	}
+
+	s.mu.Lock()
+	if plan.AgentVersion != "" {
+		s.agentVersion = plan.AgentVersion
+	}
+	if plan.ImageName != "" {
+		s.imageName = plan.ImageName
+	}
+	s.bootTime = s.clock.Now()
+	glog.Infof(s.switchName + ": rebooted with agent " + s.agentVersion + ", image " + s.imageName + "\n")
+	s.mu.Unlock()
+
+	if !s.register(ctx, allToMainLoop) {
+		allToMainLoop <- s.switchName
+	}
+}
+
+// rollingUpgrade upgrades the switches batch by batch.
+func rollingUpgrade(ctx context.Context, switches []*Switch, plan UpgradePlan, allToMainLoop chan string) {
+	if plan.BatchSize < 1 {
+		plan.BatchSize = 1
+	}
+	if !sleep(ctx, plan.Start) {
+		return
+	}
+	for i := 0; i < len(switches); i += plan.BatchSize {
+		end := i + plan.BatchSize
+		if end > len(switches) {
+			end = len(switches)
+		}
+		glog.Infof("Upgrading switches %d to %d of %d\n", i+1, end, len(switches))
+		for _, s := range switches[i:end] {
+			go s.upgrade(ctx, plan, allToMainLoop)
+		}
+		if end < len(switches) && !sleep(ctx, plan.Interval) {
+			return
+		}
+	}
+}